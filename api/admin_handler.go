@@ -0,0 +1,89 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"http-load-balancer/lib/conntrack"
+	"http-load-balancer/limiter"
+	"http-load-balancer/registry"
+)
+
+type AdminHandler struct {
+	registry *registry.Registry
+	conns    *conntrack.Tracker
+	shadow   *limiter.ShadowRecorder
+}
+
+func NewAdminHandler(
+	registry *registry.Registry,
+	conns *conntrack.Tracker,
+	shadow *limiter.ShadowRecorder,
+) *AdminHandler {
+	return &AdminHandler{
+		registry: registry,
+		conns:    conns,
+		shadow:   shadow,
+	}
+}
+
+type backendConns struct {
+	BackendID   uint64 `json:"backend_id"`
+	URL         string `json:"url"`
+	ActiveConns int64  `json:"active_conns"`
+}
+
+func (h *AdminHandler) GetConnections(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	backends := h.registry.All()
+	snapshot := h.conns.Snapshot()
+	conns := make([]backendConns, 0, len(backends))
+	for _, b := range backends {
+		conns = append(conns, backendConns{
+			BackendID:   b.ID,
+			URL:         b.URL,
+			ActiveConns: snapshot[b.ID],
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":      "success",
+		"connections": conns,
+	})
+}
+
+// GetShadowReport lists clients in shadow mode that would have been
+// rejected within the window query parameter (a Go duration, 1h by
+// default).
+func (h *AdminHandler) GetShadowReport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	window := time.Hour
+	if raw := r.URL.Query().Get("window"); raw != "" {
+		var err error
+		window, err = time.ParseDuration(raw)
+		if err != nil || window <= 0 {
+			http.Error(w, "Invalid window", http.StatusBadRequest)
+			return
+		}
+	}
+	window = min(window, h.shadow.Retention())
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":  "success",
+		"window":  window.String(),
+		"clients": h.shadow.Report(window),
+	})
+}
@@ -0,0 +1,361 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"http-load-balancer/healthcheck"
+	"http-load-balancer/lib/conntrack"
+	"http-load-balancer/models"
+	"http-load-balancer/registry"
+	"http-load-balancer/repository"
+)
+
+// BackendHandler manages backends at runtime. Changes are stored in the DB
+// and then put into the registry, so they apply to the next request.
+type BackendHandler struct {
+	backendRepo     repository.BackendRepository
+	registry        *registry.Registry
+	healthEventRepo repository.HealthEventRepository
+	healthChecker   *healthcheck.HealthChecker
+	conns           *conntrack.Tracker
+}
+
+func NewBackendHandler(
+	backendRepo repository.BackendRepository,
+	registry *registry.Registry,
+	healthEventRepo repository.HealthEventRepository,
+	healthChecker *healthcheck.HealthChecker,
+	conns *conntrack.Tracker,
+) *BackendHandler {
+	return &BackendHandler{
+		backendRepo:     backendRepo,
+		registry:        registry,
+		healthEventRepo: healthEventRepo,
+		healthChecker:   healthChecker,
+		conns:           conns,
+	}
+}
+
+type backendView struct {
+	ID          uint64    `json:"backend_id"`
+	URL         string    `json:"url"`
+	State       string    `json:"state"`
+	IsAlive     bool      `json:"is_alive"`
+	Weight      int       `json:"weight"`
+	MaxRPS      int       `json:"max_rps"`
+	ActiveConns int64     `json:"active_conns"`
+	Drained     bool      `json:"drained"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+func (h *BackendHandler) view(b models.Backend) backendView {
+	conns := h.conns.Load(b.ID)
+	return backendView{
+		ID:          b.ID,
+		URL:         b.URL,
+		State:       b.State,
+		IsAlive:     b.IsAlive,
+		Weight:      b.Weight,
+		MaxRPS:      b.MaxRPS,
+		ActiveConns: conns,
+		Drained:     b.State == models.BackendDraining && conns == 0,
+		CreatedAt:   b.CreatedAt,
+		UpdatedAt:   b.UpdatedAt,
+	}
+}
+
+type backendRequest struct {
+	URL    *string `json:"url,omitempty"`
+	State  *string `json:"state,omitempty"`
+	Weight *int    `json:"weight,omitempty"`
+	MaxRPS *int    `json:"max_rps,omitempty"`
+}
+
+func (req backendRequest) apply(b *models.Backend) {
+	if req.URL != nil {
+		b.URL = *req.URL
+	}
+	if req.State != nil {
+		b.State = *req.State
+	}
+	if req.Weight != nil {
+		b.Weight = *req.Weight
+	}
+	if req.MaxRPS != nil {
+		b.MaxRPS = *req.MaxRPS
+	}
+}
+
+func validateBackend(b models.Backend) error {
+	if b.URL == "" || strings.Contains(b.URL, "://") {
+		return errors.New("url must be host:port without a scheme")
+	}
+	if u, err := url.Parse("http://" + b.URL); err != nil || u.Host == "" {
+		return fmt.Errorf("invalid url %q", b.URL)
+	}
+	switch b.State {
+	case models.BackendEnabled, models.BackendDraining, models.BackendDisabled:
+	default:
+		return fmt.Errorf("state must be one of %s, %s, %s",
+			models.BackendEnabled, models.BackendDraining, models.BackendDisabled)
+	}
+	if b.Weight <= 0 {
+		return errors.New("weight must be positive")
+	}
+	if b.MaxRPS < 0 {
+		return errors.New("max_rps must not be negative")
+	}
+	return nil
+}
+
+func (h *BackendHandler) GetBackends(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	backends := h.registry.All()
+	views := make([]backendView, 0, len(backends))
+	for _, b := range backends {
+		views = append(views, h.view(b))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":   "success",
+		"backends": views,
+	})
+}
+
+func (h *BackendHandler) GetBackend(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	backendID, err := strconv.ParseUint(r.PathValue("backend_id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid backend_id", http.StatusBadRequest)
+		return
+	}
+
+	backend, ok := h.registry.Get(backendID)
+	if !ok {
+		http.Error(w, "Backend not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":  "success",
+		"backend": h.view(backend),
+	})
+}
+
+func (h *BackendHandler) CreateBackend(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	if r.Header.Get("Content-Type") != "application/json" {
+		http.Error(w, "Content-Type must be application/json", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	var backendReq backendRequest
+	if err := json.NewDecoder(r.Body).Decode(&backendReq); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	now := time.Now()
+	backend := models.Backend{
+		// assumed alive until the first health check says otherwise
+		IsAlive:   true,
+		State:     models.BackendEnabled,
+		Weight:    1,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	backendReq.apply(&backend)
+	if err := validateBackend(backend); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	created, err := h.backendRepo.Add(&backend)
+	if err != nil {
+		if errors.Is(err, repository.ErrBackendExists) {
+			http.Error(w, "Backend with this url already exists", http.StatusConflict)
+			return
+		}
+		http.Error(w, "Failed to create backend", http.StatusInternalServerError)
+		return
+	}
+	h.registry.Put(*created)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":  "success",
+		"backend": h.view(*created),
+	})
+}
+
+func (h *BackendHandler) UpdateBackend(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPatch {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	backendID, err := strconv.ParseUint(r.PathValue("backend_id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid backend_id", http.StatusBadRequest)
+		return
+	}
+
+	var backendReq backendRequest
+	if err := json.NewDecoder(r.Body).Decode(&backendReq); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	backend, err := h.backendRepo.GetByID(backendID)
+	if err != nil {
+		if errors.Is(err, repository.ErrBackendNotFound) {
+			http.Error(w, "Backend not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	backendReq.apply(&backend)
+	if err := validateBackend(backend); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.backendRepo.Update(&backend); err != nil {
+		switch {
+		case errors.Is(err, repository.ErrBackendNotFound):
+			http.Error(w, "Backend not found", http.StatusNotFound)
+		case errors.Is(err, repository.ErrBackendExists):
+			http.Error(w, "Backend with this url already exists", http.StatusConflict)
+		default:
+			http.Error(w, "Failed to update backend", http.StatusInternalServerError)
+		}
+		return
+	}
+	h.registry.Put(backend)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":  "success",
+		"backend": h.view(backend),
+	})
+}
+
+// DeleteBackend removes a backend right away; requests already proxied to
+// it still complete. Drain it first to be sure it is idle.
+func (h *BackendHandler) DeleteBackend(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	backendID, err := strconv.ParseUint(r.PathValue("backend_id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid backend_id", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.backendRepo.Delete(backendID); err != nil {
+		if errors.Is(err, repository.ErrBackendNotFound) {
+			http.Error(w, "Backend not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to delete backend", http.StatusInternalServerError)
+		return
+	}
+	h.registry.Remove(backendID)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":     "success",
+		"backend_id": backendID,
+	})
+}
+
+const (
+	defaultHealthHistory = 50
+	maxHealthHistory     = 500
+)
+
+// GetBackendHealth returns the backend's latest check and its recent
+// transitions between up and down, newest first (?limit=, 50 by default).
+func (h *BackendHandler) GetBackendHealth(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	backendID, err := strconv.ParseUint(r.PathValue("backend_id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid backend_id", http.StatusBadRequest)
+		return
+	}
+
+	limit := defaultHealthHistory
+	if s := r.URL.Query().Get("limit"); s != "" {
+		limit, err = strconv.Atoi(s)
+		if err != nil || limit <= 0 || limit > maxHealthHistory {
+			http.Error(w, fmt.Sprintf("limit must be between 1 and %d", maxHealthHistory), http.StatusBadRequest)
+			return
+		}
+	}
+
+	backend, ok := h.registry.Get(backendID)
+	if !ok {
+		http.Error(w, "Backend not found", http.StatusNotFound)
+		return
+	}
+
+	history, err := h.healthEventRepo.GetByBackend(backendID, limit)
+	if err != nil {
+		http.Error(w, "Failed to get health history", http.StatusInternalServerError)
+		return
+	}
+
+	// null until the backend has been checked
+	var check *healthcheck.Status
+	if status, ok := h.healthChecker.Status(backendID); ok {
+		check = &status
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":     "success",
+		"backend_id": backend.ID,
+		"is_alive":   backend.IsAlive,
+		"state":      backend.State,
+		"check":      check,
+		"history":    history,
+	})
+}
@@ -3,19 +3,41 @@ package api
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
 
+	"http-load-balancer/identity"
+	"http-load-balancer/limiter"
 	"http-load-balancer/models"
 	"http-load-balancer/repository"
 )
 
 type ClientHandler struct {
-	userRepo repository.UserRepository
+	userRepo    repository.UserRepository
+	limiter     *limiter.Store
+	plans       *limiter.PlanResolver
+	quotas      *limiter.Quotas
+	concurrency *limiter.Concurrency
+	apiKeys     *identity.APIKey
 }
 
-func NewClientHandler(userRepo repository.UserRepository) *ClientHandler {
-	return &ClientHandler{userRepo: userRepo}
+func NewClientHandler(
+	userRepo repository.UserRepository,
+	plans *limiter.PlanResolver,
+	limiter *limiter.Store,
+	quotas *limiter.Quotas,
+	concurrency *limiter.Concurrency,
+	apiKeys *identity.APIKey,
+) *ClientHandler {
+	return &ClientHandler{
+		userRepo:    userRepo,
+		limiter:     limiter,
+		plans:       plans,
+		quotas:      quotas,
+		concurrency: concurrency,
+		apiKeys:     apiKeys,
+	}
 }
 
 func (h *ClientHandler) CreateClient(w http.ResponseWriter, r *http.Request) {
@@ -30,8 +52,9 @@ func (h *ClientHandler) CreateClient(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var clientReq struct {
-		Capacity   int `json:"capacity"`
-		RatePerSec int `json:"rate_per_sec"`
+		clientLimits
+		Algorithm string `json:"algorithm"`
+		Shadow    bool   `json:"shadow"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&clientReq); err != nil {
@@ -40,32 +63,39 @@ func (h *ClientHandler) CreateClient(w http.ResponseWriter, r *http.Request) {
 	}
 	defer r.Body.Close()
 
-	if clientReq.Capacity <= 0 {
-		http.Error(w, "capacity must be positive", http.StatusBadRequest)
+	if err := clientReq.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	if clientReq.RatePerSec <= 0 {
-		http.Error(w, "rate_per_sec must be positive", http.StatusBadRequest)
+	if clientReq.Algorithm == "" {
+		clientReq.Algorithm = limiter.AlgorithmTokenBucket
+	}
+	if err := limiter.ValidateAlgorithm(clientReq.Algorithm); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	reqUser := &models.User{
-		Capacity:   clientReq.Capacity,
-		RatePerSec: clientReq.RatePerSec,
-	}
+	reqUser := &models.User{Algorithm: clientReq.Algorithm, Shadow: clientReq.Shadow}
+	clientReq.apply(reqUser)
 
 	user, err := h.userRepo.Create(reqUser)
 	if err != nil {
+		if errors.Is(err, repository.ErrPlanNotFound) {
+			http.Error(w, "Plan not found", http.StatusBadRequest)
+			return
+		}
 		http.Error(w, "Failed to create client", http.StatusInternalServerError)
 		return
 	}
+	// drop a cached miss for the new ID
+	h.limiter.Forget(user.ID)
+
+	resp := clientResponse(*user)
+	resp["api_key"] = user.APIKey
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"status":    "success",
-		"client_id": user.ID,
-	})
+	json.NewEncoder(w).Encode(resp)
 }
 
 func (h *ClientHandler) DeleteClient(w http.ResponseWriter, r *http.Request) {
@@ -93,6 +123,10 @@ func (h *ClientHandler) DeleteClient(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Failed to delete client", http.StatusInternalServerError)
 		return
 	}
+	h.limiter.Forget(clientID)
+	h.quotas.Remove(clientID)
+	h.concurrency.Forget(clientID)
+	h.apiKeys.Forget(clientID)
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
@@ -103,6 +137,40 @@ func (h *ClientHandler) DeleteClient(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// RotateAPIKey gives a client a new API key; the old one stops working at
+// once.
+func (h *ClientHandler) RotateAPIKey(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	clientID, err := strconv.ParseUint(r.PathValue("client_id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid client_id", http.StatusBadRequest)
+		return
+	}
+
+	apiKey, err := h.userRepo.RotateAPIKey(clientID)
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			http.Error(w, "Client not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to rotate API key", http.StatusInternalServerError)
+		return
+	}
+	h.apiKeys.Forget(clientID)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":    "success",
+		"client_id": clientID,
+		"api_key":   apiKey,
+	})
+}
+
 func (h *ClientHandler) UpdateClientParams(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPatch {
 		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
@@ -119,9 +187,13 @@ func (h *ClientHandler) UpdateClientParams(w http.ResponseWriter, r *http.Reques
 	}
 
 	var updateReq struct {
-		Capacity   int `json:"capacity,omitempty"`
-		RatePerSec int `json:"rate_per_sec,omitempty"`
-		Tokens     int `json:"tokens,omitempty"`
+		clientLimits
+		Tokens    *int   `json:"tokens,omitempty"`
+		Algorithm string `json:"algorithm,omitempty"`
+		Shadow    *bool  `json:"shadow,omitempty"`
+		// Inherit lists overrides to drop so the plan's value applies again;
+		// "plan_id" moves the client back to the default plan.
+		Inherit []string `json:"inherit,omitempty"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&updateReq); err != nil {
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
@@ -129,18 +201,24 @@ func (h *ClientHandler) UpdateClientParams(w http.ResponseWriter, r *http.Reques
 	}
 	defer r.Body.Close()
 
-	if updateReq.Capacity <= 0 {
-		http.Error(w, "Capacity must be positive", http.StatusBadRequest)
+	if err := updateReq.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	if updateReq.RatePerSec <= 0 {
-		http.Error(w, "Rate_per_sec must be positive", http.StatusBadRequest)
+	if updateReq.Tokens != nil && *updateReq.Tokens < 0 {
+		http.Error(w, "tokens must not be negative", http.StatusBadRequest)
 		return
 	}
-	if updateReq.Tokens <= 0 {
-		http.Error(w, "Tokens must be positive", http.StatusBadRequest)
+	if updateReq.Algorithm != "" {
+		if err := limiter.ValidateAlgorithm(updateReq.Algorithm); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 	}
 
+	// flush the tokens the client has in memory first, so the update
+	// doesn't overwrite them with the stale ones from the DB
+	h.limiter.Forget(clientID)
 	existingUser, err := h.userRepo.GetByID(clientID)
 	if err != nil {
 		if errors.Is(err, repository.ErrUserNotFound) {
@@ -151,22 +229,220 @@ func (h *ClientHandler) UpdateClientParams(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	existingUser.Capacity = updateReq.Capacity
-	existingUser.RatePerSec = updateReq.RatePerSec
-	existingUser.Tokens = updateReq.Tokens
+	if err := inherit(&existingUser, updateReq.Inherit); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	updateReq.apply(&existingUser)
+	if updateReq.Tokens != nil {
+		existingUser.Tokens = *updateReq.Tokens
+	}
+	if updateReq.Algorithm != "" {
+		existingUser.Algorithm = updateReq.Algorithm
+	}
+	if updateReq.Shadow != nil {
+		existingUser.Shadow = *updateReq.Shadow
+	}
 
 	if err := h.userRepo.Update(&existingUser); err != nil {
+		if errors.Is(err, repository.ErrPlanNotFound) {
+			http.Error(w, "Plan not found", http.StatusBadRequest)
+			return
+		}
 		http.Error(w, "Failed to update client", http.StatusInternalServerError)
 		return
 	}
+	h.limiter.Forget(clientID)
+	h.quotas.Forget(clientID)
+	h.concurrency.Forget(clientID)
+
+	resp := clientResponse(existingUser)
+	resp["tokens"] = existingUser.Tokens
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]interface{}{
+	json.NewEncoder(w).Encode(resp)
+}
+
+// GetClient returns a client's overrides together with the limits it is
+// actually held to.
+func (h *ClientHandler) GetClient(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	clientID, err := strconv.ParseUint(r.PathValue("client_id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid client_id", http.StatusBadRequest)
+		return
+	}
+
+	user, limits, err := h.plans.Resolve(clientID)
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			http.Error(w, "Client not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	resp := clientResponse(user)
+	resp["limits"] = map[string]interface{}{
+		"plan_id":        limits.PlanID,
+		"plan":           limits.PlanName,
+		"capacity":       limits.Capacity,
+		"rate_per_sec":   limits.RatePerSec,
+		"window_sec":     int(limits.Window.Seconds()),
+		"quota_limit":    limits.QuotaLimit,
+		"quota_period":   limits.QuotaPeriod,
+		"max_concurrent": limits.MaxConcurrent,
+		"priority":       limits.Priority,
+		"shadow":         limits.Shadow,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (h *ClientHandler) GetClientUsage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	clientID, err := strconv.ParseUint(r.PathValue("client_id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid client_id", http.StatusBadRequest)
+		return
+	}
+
+	usage, err := h.quotas.Usage(clientID)
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			http.Error(w, "Client not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	resp := map[string]interface{}{
 		"status":       "success",
 		"client_id":    clientID,
-		"capacity":     existingUser.Capacity,
-		"rate_per_sec": existingUser.RatePerSec,
-		"tokens":       existingUser.Tokens,
-	})
+		"period":       usage.Period,
+		"used":         usage.Used,
+		"quota_limit":  usage.Limit,
+		"window_start": usage.WindowStart,
+		"window_end":   usage.WindowEnd,
+	}
+	if usage.Limit > 0 {
+		resp["remaining"] = max(usage.Limit-usage.Used, 0)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// clientLimits are the plan and the per-client overrides of plan limits
+// accepted by POST and PATCH /clients. Omitted fields are left as they are.
+type clientLimits struct {
+	PlanID        *uint64 `json:"plan_id,omitempty"`
+	Capacity      *int    `json:"capacity,omitempty"`
+	RatePerSec    *int    `json:"rate_per_sec,omitempty"`
+	WindowSec     *int    `json:"window_sec,omitempty"`
+	QuotaLimit    *int64  `json:"quota_limit,omitempty"`
+	QuotaPeriod   *string `json:"quota_period,omitempty"`
+	MaxConcurrent *int    `json:"max_concurrent,omitempty"`
+}
+
+func (l clientLimits) validate() error {
+	if l.Capacity != nil && *l.Capacity <= 0 {
+		return errors.New("capacity must be positive")
+	}
+	if l.RatePerSec != nil && *l.RatePerSec <= 0 {
+		return errors.New("rate_per_sec must be positive")
+	}
+	if l.WindowSec != nil && *l.WindowSec <= 0 {
+		return errors.New("window_sec must be positive")
+	}
+	if l.QuotaLimit != nil && *l.QuotaLimit < 0 {
+		return errors.New("quota_limit must not be negative")
+	}
+	if l.QuotaPeriod != nil {
+		if err := limiter.ValidateQuotaPeriod(*l.QuotaPeriod); err != nil {
+			return err
+		}
+	}
+	if l.MaxConcurrent != nil && *l.MaxConcurrent < 0 {
+		return errors.New("max_concurrent must not be negative")
+	}
+	return nil
+}
+
+func (l clientLimits) apply(user *models.User) {
+	if l.PlanID != nil {
+		user.PlanID = l.PlanID
+	}
+	if l.Capacity != nil {
+		user.Capacity = l.Capacity
+	}
+	if l.RatePerSec != nil {
+		user.RatePerSec = l.RatePerSec
+	}
+	if l.WindowSec != nil {
+		user.WindowSec = l.WindowSec
+	}
+	if l.QuotaLimit != nil {
+		user.QuotaLimit = l.QuotaLimit
+	}
+	if l.QuotaPeriod != nil {
+		user.QuotaPeriod = l.QuotaPeriod
+	}
+	if l.MaxConcurrent != nil {
+		user.MaxConcurrent = l.MaxConcurrent
+	}
+}
+
+func inherit(user *models.User, fields []string) error {
+	for _, field := range fields {
+		switch field {
+		case "plan_id":
+			user.PlanID = nil
+		case "capacity":
+			user.Capacity = nil
+		case "rate_per_sec":
+			user.RatePerSec = nil
+		case "window_sec":
+			user.WindowSec = nil
+		case "quota_limit":
+			user.QuotaLimit = nil
+		case "quota_period":
+			user.QuotaPeriod = nil
+		case "max_concurrent":
+			user.MaxConcurrent = nil
+		default:
+			return fmt.Errorf("unknown field in inherit: %q", field)
+		}
+	}
+	return nil
+}
+
+func clientResponse(user models.User) map[string]interface{} {
+	return map[string]interface{}{
+		"status":         "success",
+		"client_id":      user.ID,
+		"plan_id":        user.PlanID,
+		"algorithm":      user.Algorithm,
+		"shadow":         user.Shadow,
+		"capacity":       user.Capacity,
+		"rate_per_sec":   user.RatePerSec,
+		"window_sec":     user.WindowSec,
+		"quota_limit":    user.QuotaLimit,
+		"quota_period":   user.QuotaPeriod,
+		"max_concurrent": user.MaxConcurrent,
+	}
 }
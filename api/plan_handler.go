@@ -0,0 +1,309 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"http-load-balancer/limiter"
+	"http-load-balancer/models"
+	"http-load-balancer/repository"
+)
+
+type PlanHandler struct {
+	planRepo    repository.PlanRepository
+	limiter     *limiter.Store
+	quotas      *limiter.Quotas
+	concurrency *limiter.Concurrency
+}
+
+func NewPlanHandler(
+	planRepo repository.PlanRepository,
+	limiter *limiter.Store,
+	quotas *limiter.Quotas,
+	concurrency *limiter.Concurrency,
+) *PlanHandler {
+	return &PlanHandler{
+		planRepo:    planRepo,
+		limiter:     limiter,
+		quotas:      quotas,
+		concurrency: concurrency,
+	}
+}
+
+type planRequest struct {
+	Name          *string `json:"name,omitempty"`
+	Capacity      *int    `json:"capacity,omitempty"`
+	RatePerSec    *int    `json:"rate_per_sec,omitempty"`
+	WindowSec     *int    `json:"window_sec,omitempty"`
+	QuotaLimit    *int64  `json:"quota_limit,omitempty"`
+	QuotaPeriod   *string `json:"quota_period,omitempty"`
+	MaxConcurrent *int    `json:"max_concurrent,omitempty"`
+	Priority      *int    `json:"priority,omitempty"`
+}
+
+func (req planRequest) apply(plan *models.Plan) {
+	if req.Name != nil {
+		plan.Name = *req.Name
+	}
+	if req.Capacity != nil {
+		plan.Capacity = *req.Capacity
+	}
+	if req.RatePerSec != nil {
+		plan.RatePerSec = *req.RatePerSec
+	}
+	if req.WindowSec != nil {
+		plan.WindowSec = *req.WindowSec
+	}
+	if req.QuotaLimit != nil {
+		plan.QuotaLimit = *req.QuotaLimit
+	}
+	if req.QuotaPeriod != nil {
+		plan.QuotaPeriod = *req.QuotaPeriod
+	}
+	if req.MaxConcurrent != nil {
+		plan.MaxConcurrent = *req.MaxConcurrent
+	}
+	if req.Priority != nil {
+		plan.Priority = *req.Priority
+	}
+}
+
+func validatePlan(plan models.Plan) error {
+	if plan.Name == "" {
+		return errors.New("name is required")
+	}
+	if plan.Capacity <= 0 {
+		return errors.New("capacity must be positive")
+	}
+	if plan.RatePerSec <= 0 {
+		return errors.New("rate_per_sec must be positive")
+	}
+	if plan.WindowSec <= 0 {
+		return errors.New("window_sec must be positive")
+	}
+	if plan.QuotaLimit < 0 {
+		return errors.New("quota_limit must not be negative")
+	}
+	if plan.MaxConcurrent < 0 {
+		return errors.New("max_concurrent must not be negative")
+	}
+	return limiter.ValidateQuotaPeriod(plan.QuotaPeriod)
+}
+
+func (h *PlanHandler) CreatePlan(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	if r.Header.Get("Content-Type") != "application/json" {
+		http.Error(w, "Content-Type must be application/json", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	var planReq planRequest
+	if err := json.NewDecoder(r.Body).Decode(&planReq); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	plan := models.Plan{WindowSec: 1, QuotaPeriod: limiter.QuotaPeriodMonth}
+	planReq.apply(&plan)
+	if err := validatePlan(plan); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	created, err := h.planRepo.Create(&plan)
+	if err != nil {
+		if errors.Is(err, repository.ErrPlanExists) {
+			http.Error(w, "Plan with this name already exists", http.StatusConflict)
+			return
+		}
+		http.Error(w, "Failed to create plan", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": "success",
+		"plan":   created,
+	})
+}
+
+func (h *PlanHandler) GetPlans(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	plans, err := h.planRepo.GetAll()
+	if err != nil {
+		http.Error(w, "Failed to get plans", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": "success",
+		"plans":  plans,
+	})
+}
+
+func (h *PlanHandler) GetPlan(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	planID, err := strconv.ParseUint(r.PathValue("plan_id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid plan_id", http.StatusBadRequest)
+		return
+	}
+
+	plan, err := h.planRepo.GetByID(planID)
+	if err != nil {
+		if errors.Is(err, repository.ErrPlanNotFound) {
+			http.Error(w, "Plan not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": "success",
+		"plan":   plan,
+	})
+}
+
+func (h *PlanHandler) UpdatePlan(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPatch {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	planID, err := strconv.ParseUint(r.PathValue("plan_id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid plan_id", http.StatusBadRequest)
+		return
+	}
+
+	var planReq planRequest
+	if err := json.NewDecoder(r.Body).Decode(&planReq); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	plan, err := h.planRepo.GetByID(planID)
+	if err != nil {
+		if errors.Is(err, repository.ErrPlanNotFound) {
+			http.Error(w, "Plan not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	if plan.Name == limiter.DefaultPlan && planReq.Name != nil && *planReq.Name != plan.Name {
+		http.Error(w, "The default plan cannot be renamed", http.StatusConflict)
+		return
+	}
+
+	planReq.apply(&plan)
+	if err := validatePlan(plan); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.planRepo.Update(&plan); err != nil {
+		switch {
+		case errors.Is(err, repository.ErrPlanNotFound):
+			http.Error(w, "Plan not found", http.StatusNotFound)
+		case errors.Is(err, repository.ErrPlanExists):
+			http.Error(w, "Plan with this name already exists", http.StatusConflict)
+		default:
+			http.Error(w, "Failed to update plan", http.StatusInternalServerError)
+		}
+		return
+	}
+	h.forgetClients(plan)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": "success",
+		"plan":   plan,
+	})
+}
+
+func (h *PlanHandler) DeletePlan(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	planID, err := strconv.ParseUint(r.PathValue("plan_id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid plan_id", http.StatusBadRequest)
+		return
+	}
+
+	plan, err := h.planRepo.GetByID(planID)
+	if err != nil {
+		if errors.Is(err, repository.ErrPlanNotFound) {
+			http.Error(w, "Plan not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	if plan.Name == limiter.DefaultPlan {
+		http.Error(w, "The default plan cannot be deleted", http.StatusConflict)
+		return
+	}
+
+	if err := h.planRepo.Delete(planID); err != nil {
+		switch {
+		case errors.Is(err, repository.ErrPlanNotFound):
+			http.Error(w, "Plan not found", http.StatusNotFound)
+		case errors.Is(err, repository.ErrPlanInUse):
+			http.Error(w, "Plan is still assigned to clients", http.StatusConflict)
+		default:
+			http.Error(w, "Failed to delete plan", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":  "success",
+		"plan_id": planID,
+	})
+}
+
+// forgetClients drops cached limits of the clients on plan, so they pick up
+// its new limits. If they can't be listed every client is forgotten.
+func (h *PlanHandler) forgetClients(plan models.Plan) {
+	ids, err := h.planRepo.ClientIDs(plan.ID, plan.Name == limiter.DefaultPlan)
+	if err != nil {
+		h.limiter.ForgetAll()
+		h.quotas.ForgetAll()
+		h.concurrency.ForgetAll()
+		return
+	}
+	for _, id := range ids {
+		h.limiter.Forget(id)
+		h.quotas.Forget(id)
+		h.concurrency.Forget(id)
+	}
+}
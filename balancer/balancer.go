@@ -1,41 +1,85 @@
 package balancer
 
 import (
-	"encoding/json"
+	"context"
 	"errors"
 	"log/slog"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
+	"strconv"
+	"time"
 
 	"http-load-balancer/healthcheck"
+	"http-load-balancer/identity"
+	"http-load-balancer/lib/breaker"
+	"http-load-balancer/lib/conntrack"
 	"http-load-balancer/lib/logger/sl"
 	"http-load-balancer/lib/strategy"
 	"http-load-balancer/limiter"
 	"http-load-balancer/models"
+	"http-load-balancer/registry"
 	"http-load-balancer/repository"
 )
 
 type Balancer struct {
 	strategy      strategy.Strategy
-	backendRepo   repository.BackendRepository
+	registry      *registry.Registry
 	healthChecker *healthcheck.HealthChecker
-	limiter       *limiter.TokenBucket
+	identifier    identity.ClientIdentifier
+	limiter       *limiter.Store
+	quotas        *limiter.Quotas
+	concurrency   *limiter.Concurrency
+	routes        *Routes
+	upstream      *limiter.Upstream
+	shadow        *limiter.ShadowRecorder
+	outliers      *healthcheck.OutlierDetector
+	breakers      *breaker.Set
+	conns         *conntrack.Tracker
+	body          BodyPolicy
+	retry         RetryPolicy
+	slowStart     SlowStartPolicy
+	budget        *retryBudget
 	log           *slog.Logger
 }
 
 func NewBalancer(
 	strategy strategy.Strategy,
-	backendRepo repository.BackendRepository,
+	registry *registry.Registry,
 	healthChecker *healthcheck.HealthChecker,
-	limiter *limiter.TokenBucket,
+	identifier identity.ClientIdentifier,
+	limiter *limiter.Store,
+	quotas *limiter.Quotas,
+	concurrency *limiter.Concurrency,
+	routes *Routes,
+	upstream *limiter.Upstream,
+	shadow *limiter.ShadowRecorder,
+	outliers *healthcheck.OutlierDetector,
+	breakers *breaker.Set,
+	conns *conntrack.Tracker,
+	body BodyPolicy,
+	retry RetryPolicy,
+	slowStart SlowStartPolicy,
 	log *slog.Logger,
 ) *Balancer {
 	return &Balancer{
 		strategy,
-		backendRepo,
+		registry,
 		healthChecker,
+		identifier,
 		limiter,
+		quotas,
+		concurrency,
+		routes,
+		upstream,
+		shadow,
+		outliers,
+		breakers,
+		conns,
+		body,
+		retry,
+		slowStart,
+		newRetryBudget(retry.BudgetRatio, retry.BudgetMin),
 		log,
 	}
 }
@@ -44,61 +88,222 @@ func (b *Balancer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	b.log.Debug("incoming request",
 		slog.String("method", req.Method),
 		slog.String("path", req.URL.Path))
-	var userID uint64
-	if req.Method == http.MethodPost {
-		if req.Body == nil || req.Body == http.NoBody {
-			b.log.Error("empty request body")
-			http.Error(w, "Request body required", http.StatusBadRequest)
+	var body *bufferedBody
+	if req.Body != nil && req.Body != http.NoBody {
+		var err error
+		body, err = readBody(req, b.body)
+		if err != nil {
+			if errors.Is(err, ErrBodyTooLarge) {
+				http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+				return
+			}
+			b.log.Error("failed to read request body", sl.Err(err))
+			http.Error(w, "Failed to read request body", http.StatusBadRequest)
 			return
 		}
+		defer body.Close()
+		body.Attach(req)
+	}
 
-		var tmpUser models.User
-		if err := json.NewDecoder(req.Body).Decode(&tmpUser); err != nil {
-			b.log.Error("failed to decode request body", sl.Err(err))
-			http.Error(w, "Invalid request body", http.StatusBadRequest)
+	userID, err := b.identifier.Identify(req)
+	if err != nil {
+		b.handleIdentityError(w, err)
+		return
+	}
+	priority := 0
+	if userID != 0 {
+		b.log.Debug("requested userID", slog.Uint64("userID", userID))
+
+		// codes of the checks a client in shadow mode failed
+		var shadowed []string
+
+		decision, err := b.limiter.Allow(userID, b.routes.Cost(req))
+		if err != nil {
+			b.handleLimiterError(w, err)
 			return
 		}
-		defer req.Body.Close()
-		userID = tmpUser.ID
-		b.log.Debug("requested userID", slog.Uint64("userID", userID))
+		switch {
+		case decision.Shadow:
+			if !decision.Allowed {
+				shadowed = append(shadowed, "rate_limit_exceeded")
+			}
+		case !decision.Allowed:
+			setRateLimitHeaders(w, decision)
+			writeProblem(w, http.StatusTooManyRequests, "rate_limit_exceeded", "Rate limit exceeded",
+				max(limiter.Seconds(decision.RetryAfter), 1))
+			return
+		default:
+			setRateLimitHeaders(w, decision)
+		}
+		priority = decision.Priority
 
-		allowed, err := b.limiter.Allow(userID)
+		quota, err := b.quotas.Allow(userID)
 		if err != nil {
 			b.handleLimiterError(w, err)
 			return
 		}
-		if !allowed {
-			http.Error(w, "Rate limit exceeded", http.StatusTooManyRequests)
+		switch {
+		case quota.Shadow:
+			if !quota.Allowed {
+				shadowed = append(shadowed, "quota_exceeded")
+			}
+		case !quota.Allowed:
+			retryAfter := max(limiter.Seconds(quota.RetryAfter), 1)
+			w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+			writeProblem(w, http.StatusTooManyRequests, "quota_exceeded", "Request quota exceeded", retryAfter)
 			return
 		}
-	}
 
-	backends, err := b.backendRepo.GetActive()
-	if err != nil {
-		b.log.Error("failed to get active backends", sl.Err(err))
-		if errors.Is(err, repository.ErrNoActiveBackends) {
-			b.log.Error("active backends not found", sl.Err(err))
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+		if decision.Shadow || quota.Shadow {
+			b.shadow.Record(userID, shadowed...)
+			if len(shadowed) > 0 {
+				b.log.Debug("shadow mode: request would have been rejected",
+					slog.Uint64("client_id", userID),
+					slog.Any("reasons", shadowed))
+			}
+		}
+
+		release, err := b.concurrency.Acquire(req.Context(), userID)
+		if err != nil {
+			b.handleConcurrencyError(w, err)
 			return
 		}
-		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		defer release()
+	}
+
+	if global := b.upstream.AllowGlobal(priority); !global.Allowed {
+		retryAfter := max(limiter.Seconds(global.RetryAfter), 1)
+		w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+		writeProblem(w, http.StatusServiceUnavailable, "global_rate_limit_exceeded",
+			"The balancer is at its global request rate limit", retryAfter)
 		return
 	}
-	b.log.Info("active backends", slog.Any("backends", backends))
 
-	backend, err := b.strategy.NextBackend(backends)
-	if err != nil {
-		if errors.Is(err, strategy.ErrNoAliveBackends) {
-			b.log.Error("active backends not found", sl.Err(err))
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+	// dead backends stay in the pool: strategies skip them, and the
+	// consistent hash ring doesn't have to be rebuilt on every health flap
+	backends := b.registry.All()
+	b.log.Info("backends", slog.Any("backends", backends))
+
+	backends = b.outliers.Filter(backends)
+
+	b.budget.recordRequest()
+	retryable := b.retry.eligible(req)
+
+	tried := make(map[uint64]struct{})
+	for attempt := 1; ; attempt++ {
+		backend, circuit, err := b.pickBackend(backends, tried, req, userID)
+		if err != nil {
+			var saturated *saturatedError
+			switch {
+			case attempt > 1:
+				b.log.Error("no backends left to retry on", sl.Err(err))
+				http.Error(w, http.StatusText(http.StatusBadGateway), http.StatusBadGateway)
+			case errors.As(err, &saturated):
+				b.log.Warn("all backends saturated")
+				retryAfter := max(limiter.Seconds(saturated.retryAfter), 1)
+				w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+				writeProblem(w, http.StatusServiceUnavailable, "upstream_saturated",
+					"All backends are at their request rate limit", retryAfter)
+			case errors.Is(err, strategy.ErrNoAliveBackends):
+				b.log.Error("active backends not found", sl.Err(err))
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+			default:
+				b.log.Error("failed to select backend", sl.Err(err))
+				http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+			}
 			return
 		}
-		b.log.Error("failed to select backend", sl.Err(err))
-		http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
-		return
+
+		// a retryable answer is only held back when there is somewhere
+		// else to send the request; otherwise the client gets it as is
+		canRetry := retryable && attempt < b.retry.MaxAttempts && b.hasUntried(backends, tried)
+		if !b.proxyRequest(w, req, &backend, circuit, canRetry) {
+			return
+		}
+
+		b.log.Warn("retrying request on another backend",
+			slog.String("method", req.Method),
+			slog.String("path", req.URL.Path),
+			slog.String("backend", backend.URL),
+			slog.Int("attempt", attempt))
+		if body != nil {
+			body.Attach(req)
+		}
+	}
+}
+
+// pickBackend asks the strategy for a backend that hasn't been tried yet,
+// whose circuit admits the request and that is below its MaxRPS, skipping
+// backends whose breaker closed or that filled up in between.
+func (b *Balancer) pickBackend(
+	backends []models.Backend,
+	tried map[uint64]struct{},
+	req *http.Request,
+	userID uint64,
+) (models.Backend, *breaker.Breaker, error) {
+	now := time.Now()
+	for {
+		candidates := make([]models.Backend, 0, len(backends))
+		var saturated []models.Backend
+		for _, backend := range backends {
+			_, backend.Tried = tried[backend.ID]
+			backend.CircuitOpen = !b.breakers.Get(backend.ID).Ready()
+			backend.Saturated = !b.upstream.Ready(backend)
+			backend.Ramp = b.slowStart.ramp(backend, now)
+			if backend.Saturated && backend.IsAlive && !backend.CircuitOpen && !backend.Tried {
+				saturated = append(saturated, backend)
+			}
+			candidates = append(candidates, backend)
+		}
+		if len(candidates) == 0 {
+			return models.Backend{}, nil, strategy.ErrNoAliveBackends
+		}
+
+		var backend models.Backend
+		var err error
+		if rs, ok := b.strategy.(strategy.RequestStrategy); ok {
+			backend, err = rs.NextBackendForRequest(candidates, req, userID)
+		} else {
+			backend, err = b.strategy.NextBackend(candidates)
+		}
+		if err != nil {
+			if len(saturated) > 0 && errors.Is(err, strategy.ErrNoAliveBackends) {
+				return models.Backend{}, nil, &saturatedError{retryAfter: b.upstream.RetryAfter(saturated)}
+			}
+			return models.Backend{}, nil, err
+		}
+		// IDs start at 1: a zero backend means the strategy found nothing
+		if backend.ID == 0 {
+			return models.Backend{}, nil, strategy.ErrNoAliveBackends
+		}
+
+		tried[backend.ID] = struct{}{}
+		circuit := b.breakers.Get(backend.ID)
+		if !circuit.Allow() {
+			b.log.Warn("circuit open", slog.String("backend", backend.URL))
+			continue
+		}
+		if !b.upstream.AllowBackend(backend) {
+			circuit.Cancel()
+			b.log.Debug("backend saturated", slog.String("backend", backend.URL))
+			continue
+		}
+		return backend, circuit, nil
 	}
+}
 
-	b.proxyRequest(w, req, &backend)
+// hasUntried reports whether a backend not tried yet could take the
+// request right now.
+func (b *Balancer) hasUntried(backends []models.Backend, tried map[uint64]struct{}) bool {
+	for _, backend := range backends {
+		if _, ok := tried[backend.ID]; ok {
+			continue
+		}
+		if backend.Ready() && b.breakers.Get(backend.ID).Ready() && b.upstream.Ready(backend) {
+			return true
+		}
+	}
+	return false
 }
 
 func (b *Balancer) StartHealthChecks() {
@@ -109,34 +314,116 @@ func (b *Balancer) StopHealthChecks() {
 	b.healthChecker.Stop()
 }
 
+func (b *Balancer) handleIdentityError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, identity.ErrNotIdentified):
+		http.Error(w, "Client identification required", http.StatusUnauthorized)
+	case errors.Is(err, identity.ErrInvalidCredentials):
+		b.log.Debug("invalid client credentials", sl.Err(err))
+		http.Error(w, "Invalid client credentials", http.StatusUnauthorized)
+	case errors.Is(err, identity.ErrInvalidBody):
+		http.Error(w, "Request body must be a JSON object", http.StatusBadRequest)
+	default:
+		b.log.Error("failed to identify client", sl.Err(err))
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	}
+}
+
 func (b *Balancer) handleLimiterError(w http.ResponseWriter, err error) {
 	switch {
 	case errors.Is(err, repository.ErrUserNotFound):
 		http.Error(w, "User not found", http.StatusNotFound)
-	case errors.Is(err, limiter.ErrRateLimitExceeded):
-		http.Error(w, "Rate limit exceeded", http.StatusTooManyRequests)
 	default:
 		b.log.Error("limiter error", sl.Err(err))
 		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 	}
 }
 
-func (b *Balancer) proxyRequest(w http.ResponseWriter, req *http.Request, backend *models.Backend) {
+func (b *Balancer) handleConcurrencyError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, limiter.ErrConcurrencyLimit):
+		w.Header().Set("Retry-After", "1")
+		writeProblem(w, http.StatusTooManyRequests, "concurrency_limit_exceeded",
+			"Too many concurrent requests", 1)
+	case errors.Is(err, limiter.ErrQueueTimeout):
+		w.Header().Set("Retry-After", "1")
+		writeProblem(w, http.StatusServiceUnavailable, "concurrency_queue_timeout",
+			"Timed out waiting for a free concurrency slot", 1)
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		b.log.Debug("client gave up while queued", sl.Err(err))
+	default:
+		b.handleLimiterError(w, err)
+	}
+}
+
+// proxyRequest makes one attempt against backend. When canRetry is set and
+// the attempt fails in a retryable way (within the retry budget), nothing
+// is written to w and true is returned so the caller can try elsewhere.
+func (b *Balancer) proxyRequest(
+	w http.ResponseWriter,
+	req *http.Request,
+	backend *models.Backend,
+	circuit *breaker.Breaker,
+	canRetry bool,
+) bool {
 	target, err := url.Parse("http://" + backend.URL)
 	if err != nil {
+		circuit.Cancel()
 		b.log.Error("invalid backend URL",
 			sl.Err(err),
 			slog.String("url", backend.URL))
 		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
-		return
+		return false
 	}
 
+	// the per-try timeout only runs until the response headers arrive: a
+	// long download or stream from a backend that answered is not a
+	// failed attempt
+	outreq := req
+	headersArrived := func() {}
+	if b.retry.PerTryTimeout > 0 {
+		ctx, cancel := context.WithCancelCause(req.Context())
+		defer cancel(nil)
+		timer := time.AfterFunc(b.retry.PerTryTimeout, func() { cancel(errPerTryTimeout) })
+		defer timer.Stop()
+		headersArrived = func() { timer.Stop() }
+		outreq = req.WithContext(ctx)
+	}
+
+	var start time.Time
+	var ttfb time.Duration
+	var status int
+	var proxyErr error
+	retry := false
 	proxy := httputil.NewSingleHostReverseProxy(target)
+	proxy.ModifyResponse = func(resp *http.Response) error {
+		headersArrived()
+		ttfb = time.Since(start)
+		status = resp.StatusCode
+		if canRetry && b.retry.retryableStatus(status) && b.budget.withdraw() {
+			return errRetryableStatus
+		}
+		return nil
+	}
 	proxy.ErrorHandler = func(w http.ResponseWriter, _ *http.Request, err error) {
+		if errors.Is(err, errRetryableStatus) {
+			retry = true
+			return
+		}
+		// the transport only reports that the context was canceled
+		if errors.Is(context.Cause(outreq.Context()), errPerTryTimeout) {
+			err = errPerTryTimeout
+		}
+
+		proxyErr = err
 		b.log.Error("proxy error",
 			sl.Err(err),
 			slog.String("backend", backend.URL))
 
+		if canRetry && req.Context().Err() == nil && retryableError(err) && b.budget.withdraw() {
+			retry = true
+			return
+		}
 		http.Error(w, http.StatusText(http.StatusBadGateway), http.StatusBadGateway)
 	}
 
@@ -144,8 +431,54 @@ func (b *Balancer) proxyRequest(w http.ResponseWriter, req *http.Request, backen
 		slog.String("method", req.Method),
 		slog.String("to", backend.URL))
 
-	req.Header.Set("X-Forwarded-For", req.RemoteAddr)
-	req.Header.Set("X-Forwarded-Host", req.Host)
+	outreq.Header.Set("X-Forwarded-For", req.RemoteAddr)
+	outreq.Header.Set("X-Forwarded-Host", req.Host)
+
+	// ServeHTTP returns (or panics with http.ErrAbortHandler) only once the
+	// response has been copied or the request failed/was aborted, so the
+	// deferred calls cover every outcome.
+	b.conns.Inc(backend.ID)
+	defer b.conns.Dec(backend.ID)
+	finished := false
+	defer func() {
+		if !finished {
+			circuit.Cancel()
+		}
+	}()
+
+	start = time.Now()
+	proxy.ServeHTTP(w, outreq)
+	finished = true
+
+	// a client that hung up tells us nothing about the backend
+	if req.Context().Err() != nil {
+		circuit.Cancel()
+		return false
+	}
+
+	success := proxyErr == nil && status < http.StatusInternalServerError
+	circuit.Done(success)
+	if !success {
+		b.reportFailure(backend)
+		return retry
+	}
+	b.outliers.ReportSuccess(backend.ID)
 
-	proxy.ServeHTTP(w, req)
+	// only successful round-trips are fed to the latency model: a fast
+	// "connection refused" must not make a dead backend look attractive.
+	// It gets the time to the response headers, so a long download or
+	// stream doesn't make a backend look slow.
+	if observer, ok := b.strategy.(strategy.LatencyObserver); ok {
+		observer.ObserveLatency(backend.ID, ttfb)
+	}
+	return retry
+}
+
+func (b *Balancer) reportFailure(backend *models.Backend) {
+	if ejectedFor, ejected := b.outliers.ReportFailure(backend.ID); ejected {
+		b.log.Warn("backend ejected",
+			slog.Uint64("backend_id", backend.ID),
+			slog.String("backend", backend.URL),
+			slog.Duration("for", ejectedFor))
+	}
 }
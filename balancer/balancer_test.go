@@ -0,0 +1,147 @@
+package balancer
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"http-load-balancer/healthcheck"
+	"http-load-balancer/identity"
+	"http-load-balancer/lib/breaker"
+	"http-load-balancer/lib/conntrack"
+	"http-load-balancer/lib/logger/slogdiscard"
+	"http-load-balancer/lib/strategy"
+	"http-load-balancer/limiter"
+	"http-load-balancer/models"
+	"http-load-balancer/registry"
+	"http-load-balancer/repository"
+)
+
+// fakeBackends serves a fixed set to the registry.
+type fakeBackends struct {
+	repository.BackendRepository
+	backends []models.Backend
+}
+
+func (f *fakeBackends) GetAll() ([]models.Backend, error) {
+	return append([]models.Backend(nil), f.backends...), nil
+}
+
+// newTestBalancer routes anonymous requests over one backend per status
+// and counts the hits every backend gets.
+func newTestBalancer(t *testing.T, retry RetryPolicy, statuses ...int) (*Balancer, []*atomic.Int32) {
+	t.Helper()
+
+	var backends []models.Backend
+	hits := make([]*atomic.Int32, len(statuses))
+	for i, status := range statuses {
+		hits[i] = &atomic.Int32{}
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			hits[i].Add(1)
+			w.WriteHeader(status)
+		}))
+		t.Cleanup(server.Close)
+		backends = append(backends, models.Backend{
+			ID:      uint64(i + 1),
+			URL:     strings.TrimPrefix(server.URL, "http://"),
+			IsAlive: true,
+			State:   models.BackendEnabled,
+		})
+	}
+
+	log := slogdiscard.NewDiscardLogger()
+	reg := registry.New(&fakeBackends{backends: backends}, time.Minute, log)
+	if err := reg.Load(); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	routes, err := NewRoutes(nil)
+	if err != nil {
+		t.Fatalf("NewRoutes: %v", err)
+	}
+
+	b := NewBalancer(
+		strategy.NewRoundRobin(),
+		reg,
+		nil,
+		identity.NewChain(false),
+		nil,
+		nil,
+		nil,
+		routes,
+		limiter.NewUpstream(0, 0, 0),
+		nil,
+		healthcheck.NewOutlierDetector(100, time.Second, time.Second, 100),
+		breaker.NewSet(breaker.Settings{}),
+		conntrack.New(),
+		BodyPolicy{},
+		retry,
+		SlowStartPolicy{},
+		log,
+	)
+	return b, hits
+}
+
+func TestBalancer_RetryableStatus(t *testing.T) {
+	retry := RetryPolicy{MaxAttempts: 3, Statuses: []int{http.StatusServiceUnavailable}, BudgetMin: 10}
+
+	tests := []struct {
+		name       string
+		statuses   []int
+		wantStatus int
+		wantHits   int32
+	}{
+		{
+			name:       "single backend returns a retryable status",
+			statuses:   []int{http.StatusServiceUnavailable},
+			wantStatus: http.StatusServiceUnavailable,
+			wantHits:   1,
+		},
+		{
+			name:       "pool smaller than max_attempts",
+			statuses:   []int{http.StatusServiceUnavailable, http.StatusServiceUnavailable},
+			wantStatus: http.StatusServiceUnavailable,
+			wantHits:   2,
+		},
+		{
+			name:       "retry lands on a healthy backend",
+			statuses:   []int{http.StatusServiceUnavailable, http.StatusOK},
+			wantStatus: http.StatusOK,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, hits := newTestBalancer(t, retry, tt.statuses...)
+
+			rec := httptest.NewRecorder()
+			b.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			var total int32
+			for i, h := range hits {
+				if n := h.Load(); n > 1 {
+					t.Errorf("backend %d hit %d times, want at most once", i+1, n)
+				}
+				total += hits[i].Load()
+			}
+			if tt.wantHits > 0 && total != tt.wantHits {
+				t.Errorf("backends hit %d times, want %d", total, tt.wantHits)
+			}
+		})
+	}
+}
+
+func TestBalancer_NoBackends(t *testing.T) {
+	b, _ := newTestBalancer(t, RetryPolicy{})
+
+	rec := httptest.NewRecorder()
+	b.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,93 @@
+package balancer
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+)
+
+type BodyPolicy struct {
+	// MemoryLimit is how much of a body is kept in memory; the rest is
+	// spilled to a temporary file.
+	MemoryLimit int64
+	// MaxSize is the largest accepted body; bigger ones get 413.
+	MaxSize int64
+}
+
+// bufferedBody is a fully read request body that can be handed out any
+// number of times: to extract the client ID and once per proxy attempt.
+type bufferedBody struct {
+	mem  []byte
+	file *os.File
+	size int64
+}
+
+func readBody(req *http.Request, policy BodyPolicy) (*bufferedBody, error) {
+	const op = "balancer.readBody"
+
+	if req.ContentLength > policy.MaxSize {
+		return nil, ErrBodyTooLarge
+	}
+
+	src := io.LimitReader(req.Body, policy.MaxSize+1)
+	mem, err := io.ReadAll(io.LimitReader(src, policy.MemoryLimit))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	bb := &bufferedBody{mem: mem, size: int64(len(mem))}
+	if bb.size > policy.MaxSize {
+		return nil, ErrBodyTooLarge
+	}
+	if bb.size < policy.MemoryLimit {
+		return bb, nil
+	}
+
+	// memory limit reached: spill whatever is left to disk
+	file, err := os.CreateTemp("", "lb-body-*")
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	bb.file = file
+	n, err := io.Copy(file, src)
+	bb.size += n
+	if err != nil {
+		bb.Close()
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if bb.size > policy.MaxSize {
+		bb.Close()
+		return nil, ErrBodyTooLarge
+	}
+	return bb, nil
+}
+
+// Reader returns a fresh reader positioned at the start of the body.
+func (bb *bufferedBody) Reader() io.ReadCloser {
+	if bb.file == nil {
+		return io.NopCloser(bytes.NewReader(bb.mem))
+	}
+	return io.NopCloser(io.MultiReader(
+		bytes.NewReader(bb.mem),
+		io.NewSectionReader(bb.file, 0, bb.size-int64(len(bb.mem))),
+	))
+}
+
+// Attach points req at a fresh copy of the body, ready to be proxied.
+func (bb *bufferedBody) Attach(req *http.Request) {
+	req.Body = bb.Reader()
+	req.ContentLength = bb.size
+	req.GetBody = func() (io.ReadCloser, error) {
+		return bb.Reader(), nil
+	}
+}
+
+func (bb *bufferedBody) Close() error {
+	if bb.file == nil {
+		return nil
+	}
+	name := bb.file.Name()
+	return errors.Join(bb.file.Close(), os.Remove(name))
+}
@@ -0,0 +1,25 @@
+package balancer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	ErrBodyTooLarge = errors.New("request body too large")
+
+	errRetryableStatus = errors.New("retryable upstream status")
+	errPerTryTimeout   = fmt.Errorf("no response headers within the per-try timeout: %w", context.DeadlineExceeded)
+)
+
+// saturatedError is returned when every backend that could take a request
+// is at its MaxRPS.
+type saturatedError struct {
+	retryAfter time.Duration
+}
+
+func (e *saturatedError) Error() string {
+	return "all backends are at their rate limit"
+}
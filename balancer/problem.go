@@ -0,0 +1,44 @@
+package balancer
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"http-load-balancer/limiter"
+)
+
+// problem is an RFC 9457 problem details body with an extra machine
+// readable code.
+type problem struct {
+	Type       string `json:"type"`
+	Title      string `json:"title"`
+	Status     int    `json:"status"`
+	Detail     string `json:"detail"`
+	Code       string `json:"code"`
+	RetryAfter int    `json:"retry_after,omitempty"`
+}
+
+func writeProblem(w http.ResponseWriter, status int, code, detail string, retryAfter int) {
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(problem{
+		Type:       "about:blank",
+		Title:      http.StatusText(status),
+		Status:     status,
+		Detail:     detail,
+		Code:       code,
+		RetryAfter: retryAfter,
+	})
+}
+
+func setRateLimitHeaders(w http.ResponseWriter, d limiter.Decision) {
+	h := w.Header()
+	h.Set("RateLimit-Limit", strconv.Itoa(d.Limit))
+	h.Set("RateLimit-Remaining", strconv.Itoa(d.Remaining))
+	h.Set("RateLimit-Reset", strconv.Itoa(limiter.Seconds(d.Reset)))
+	if !d.Allowed {
+		h.Set("Retry-After", strconv.Itoa(max(limiter.Seconds(d.RetryAfter), 1)))
+	}
+}
@@ -0,0 +1,110 @@
+package balancer
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+)
+
+const retryBudgetWindow = 10 * time.Second
+
+type RetryPolicy struct {
+	// MaxAttempts is the total number of tries per request, including the
+	// first one. 1 or less disables retries.
+	MaxAttempts int
+	// Statuses are upstream response codes that trigger a retry.
+	Statuses []int
+	// PerTryTimeout bounds how long every single attempt may wait for the
+	// response headers; zero means no limit. The body is not limited.
+	PerTryTimeout time.Duration
+	// RetryPost makes POST and PATCH retryable even without an
+	// Idempotency-Key header.
+	RetryPost bool
+	// BudgetRatio caps retries at this fraction of requests, e.g. 0.2 for
+	// at most 20% extra load on upstreams.
+	BudgetRatio float64
+	// BudgetMin retries per window are always allowed, so low-traffic
+	// periods can still retry.
+	BudgetMin int
+}
+
+func (p RetryPolicy) eligible(req *http.Request) bool {
+	if p.MaxAttempts <= 1 {
+		return false
+	}
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace,
+		http.MethodPut, http.MethodDelete:
+		return true
+	default:
+		return p.RetryPost || req.Header.Get("Idempotency-Key") != ""
+	}
+}
+
+func (p RetryPolicy) retryableStatus(status int) bool {
+	return slices.Contains(p.Statuses, status)
+}
+
+// retryableError reports whether the attempt failed before the backend
+// could have acted on the request: a refused/failed dial or our own
+// per-try timeout.
+func retryableError(err error) bool {
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return true
+	}
+	return errors.Is(err, context.DeadlineExceeded)
+}
+
+// retryBudget limits retries to ratio * requests (plus a floor of min) per
+// fixed window so that a failing pool isn't hit with a retry storm.
+type retryBudget struct {
+	ratio float64
+	min   int
+
+	mu          sync.Mutex
+	windowStart time.Time
+	requests    int
+	retries     int
+}
+
+func newRetryBudget(ratio float64, minRetries int) *retryBudget {
+	return &retryBudget{
+		ratio:       ratio,
+		min:         minRetries,
+		windowStart: time.Now(),
+	}
+}
+
+func (rb *retryBudget) recordRequest() {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+
+	rb.rollWindow()
+	rb.requests++
+}
+
+func (rb *retryBudget) withdraw() bool {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+
+	rb.rollWindow()
+	allowed := max(float64(rb.min), rb.ratio*float64(rb.requests))
+	if float64(rb.retries) >= allowed {
+		return false
+	}
+	rb.retries++
+	return true
+}
+
+func (rb *retryBudget) rollWindow() {
+	if time.Since(rb.windowStart) >= retryBudgetWindow {
+		rb.windowStart = time.Now()
+		rb.requests = 0
+		rb.retries = 0
+	}
+}
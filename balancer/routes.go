@@ -0,0 +1,84 @@
+package balancer
+
+import (
+	"fmt"
+	"net/http"
+
+	"http-load-balancer/limiter"
+)
+
+// RouteRule charges requests matching Method and Path Cost tokens, from a
+// bucket of their own when Bucket is set. Capacity and RatePerSec size that
+// bucket; zero takes the client's own limits.
+type RouteRule struct {
+	Method     string
+	Path       string
+	Cost       int
+	Bucket     string
+	Capacity   int
+	RatePerSec int
+}
+
+// Routes maps requests to what they cost. Paths use http.ServeMux pattern
+// syntax ("/export/", "/items/{id}"), so the most specific rule wins.
+// Requests matching no rule cost one token from the main bucket.
+type Routes struct {
+	mux   *http.ServeMux
+	costs map[string]limiter.Cost
+}
+
+func NewRoutes(rules []RouteRule) (*Routes, error) {
+	r := &Routes{
+		mux:   http.NewServeMux(),
+		costs: make(map[string]limiter.Cost, len(rules)),
+	}
+	buckets := make(map[string]RouteRule)
+	for _, rule := range rules {
+		if rule.Cost < 1 {
+			return nil, fmt.Errorf("route %s %s: cost must be at least 1", rule.Method, rule.Path)
+		}
+		if rule.Bucket == "" && (rule.Capacity != 0 || rule.RatePerSec != 0) {
+			return nil, fmt.Errorf("route %s %s: capacity and rate_per_sec need a bucket", rule.Method, rule.Path)
+		}
+		if other, ok := buckets[rule.Bucket]; ok && rule.Bucket != "" &&
+			(other.Capacity != rule.Capacity || other.RatePerSec != rule.RatePerSec) {
+			return nil, fmt.Errorf("bucket %q: routes disagree on its capacity or rate", rule.Bucket)
+		}
+		buckets[rule.Bucket] = rule
+
+		pattern := rule.Path
+		if rule.Method != "" {
+			pattern = rule.Method + " " + rule.Path
+		}
+		if err := r.register(pattern); err != nil {
+			return nil, fmt.Errorf("route %q: %w", pattern, err)
+		}
+		r.costs[pattern] = limiter.Cost{
+			Bucket:     rule.Bucket,
+			Tokens:     rule.Cost,
+			Capacity:   rule.Capacity,
+			RatePerSec: rule.RatePerSec,
+		}
+	}
+	return r, nil
+}
+
+// register adds pattern to the mux, turning its panics on invalid or
+// conflicting patterns into errors.
+func (r *Routes) register(pattern string) (err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			err = fmt.Errorf("%v", v)
+		}
+	}()
+	r.mux.Handle(pattern, http.NotFoundHandler())
+	return nil
+}
+
+func (r *Routes) Cost(req *http.Request) limiter.Cost {
+	_, pattern := r.mux.Handler(req)
+	if cost, ok := r.costs[pattern]; ok {
+		return cost
+	}
+	return limiter.Cost{Tokens: 1}
+}
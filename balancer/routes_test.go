@@ -0,0 +1,63 @@
+package balancer
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNewRoutes(t *testing.T) {
+	tests := []struct {
+		name    string
+		rules   []RouteRule
+		wantErr bool
+	}{
+		{name: "cost 1", rules: []RouteRule{{Path: "/a", Cost: 1}}},
+		{name: "zero cost", rules: []RouteRule{{Path: "/a", Cost: 0}}, wantErr: true},
+		{name: "negative cost", rules: []RouteRule{{Path: "/a", Cost: -1}}, wantErr: true},
+		{name: "capacity without bucket", rules: []RouteRule{{Path: "/a", Cost: 1, Capacity: 5}}, wantErr: true},
+		{
+			name: "bucket sizes disagree",
+			rules: []RouteRule{
+				{Path: "/a", Cost: 1, Bucket: "b", Capacity: 5},
+				{Path: "/c", Cost: 1, Bucket: "b", Capacity: 6},
+			},
+			wantErr: true,
+		},
+		{name: "invalid pattern", rules: []RouteRule{{Path: "a", Cost: 1}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewRoutes(tt.rules)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRoutesCost(t *testing.T) {
+	routes, err := NewRoutes([]RouteRule{
+		{Method: "GET", Path: "/export/", Cost: 100, Bucket: "export"},
+		{Path: "/search", Cost: 2},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		method, path string
+		wantTokens   int
+		wantBucket   string
+	}{
+		{"GET", "/export/orders", 100, "export"},
+		{"POST", "/export/orders", 1, ""},
+		{"GET", "/search", 2, ""},
+		{"GET", "/other", 1, ""},
+	}
+	for _, tt := range tests {
+		cost := routes.Cost(httptest.NewRequest(tt.method, tt.path, nil))
+		if cost.Tokens != tt.wantTokens || cost.Bucket != tt.wantBucket {
+			t.Errorf("%s %s: cost = %+v, want %d tokens from %q", tt.method, tt.path, cost, tt.wantTokens, tt.wantBucket)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package balancer
+
+import (
+	"math"
+	"time"
+
+	"http-load-balancer/models"
+)
+
+type SlowStartPolicy struct {
+	// Window is how long a newly added or recovered backend takes to reach
+	// its full weight. Zero disables slow start.
+	Window time.Duration
+	// MinWeight is the share of its weight a backend starts with.
+	MinWeight float64
+	// Aggression shapes the ramp: 1 is linear, higher values hand out
+	// traffic faster early in the window, lower ones slower.
+	Aggression float64
+}
+
+// ramp is the share of its weight backend gets at now, for Backend.Ramp.
+func (p SlowStartPolicy) ramp(backend models.Backend, now time.Time) float64 {
+	if p.Window <= 0 || backend.ReadySince.IsZero() {
+		return 0
+	}
+	elapsed := now.Sub(backend.ReadySince)
+	if elapsed >= p.Window {
+		return 0
+	}
+
+	aggression := p.Aggression
+	if aggression <= 0 {
+		aggression = 1
+	}
+	progress := math.Pow(float64(elapsed)/float64(p.Window), 1/aggression)
+	return min(max(progress, p.MinWeight, 0.01), 1)
+}
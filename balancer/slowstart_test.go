@@ -0,0 +1,55 @@
+package balancer
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"http-load-balancer/models"
+)
+
+func TestSlowStartRamp(t *testing.T) {
+	readySince := time.Unix(1_200_000, 0)
+	at := func(elapsed time.Duration) time.Time { return readySince.Add(elapsed) }
+	ready := models.Backend{ID: 1, ReadySince: readySince}
+
+	tests := []struct {
+		name    string
+		policy  SlowStartPolicy
+		backend models.Backend
+		now     time.Time
+		want    float64
+	}{
+		{name: "disabled", policy: SlowStartPolicy{}, backend: ready, now: at(time.Second), want: 0},
+		{name: "ready at startup", policy: SlowStartPolicy{Window: 10 * time.Second}, backend: models.Backend{ID: 1}, now: at(time.Second), want: 0},
+		{name: "just ready", policy: SlowStartPolicy{Window: 10 * time.Second}, backend: ready, now: at(0), want: 0.01},
+		{name: "min weight", policy: SlowStartPolicy{Window: 10 * time.Second, MinWeight: 0.1}, backend: ready, now: at(time.Second / 2), want: 0.1},
+		{name: "linear quarter", policy: SlowStartPolicy{Window: 10 * time.Second}, backend: ready, now: at(2500 * time.Millisecond), want: 0.25},
+		{name: "linear half", policy: SlowStartPolicy{Window: 10 * time.Second, Aggression: 1}, backend: ready, now: at(5 * time.Second), want: 0.5},
+		{name: "aggressive", policy: SlowStartPolicy{Window: 10 * time.Second, Aggression: 2}, backend: ready, now: at(2500 * time.Millisecond), want: 0.5},
+		{name: "cautious", policy: SlowStartPolicy{Window: 10 * time.Second, Aggression: 0.5}, backend: ready, now: at(5 * time.Second), want: 0.25},
+		{name: "window over", policy: SlowStartPolicy{Window: 10 * time.Second}, backend: ready, now: at(10 * time.Second), want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.policy.ramp(tt.backend, tt.now)
+			if math.Abs(got-tt.want) > 1e-9 {
+				t.Fatalf("ramp = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSlowStartRampGrows(t *testing.T) {
+	policy := SlowStartPolicy{Window: time.Minute, MinWeight: 0.05, Aggression: 1.5}
+	backend := models.Backend{ID: 1, ReadySince: time.Unix(1_200_000, 0)}
+
+	prev := 0.0
+	for elapsed := time.Duration(0); elapsed < policy.Window; elapsed += time.Second {
+		ramp := policy.ramp(backend, backend.ReadySince.Add(elapsed))
+		if ramp < prev || ramp <= 0 || ramp > 1 {
+			t.Fatalf("ramp at %v = %v after %v", elapsed, ramp, prev)
+		}
+		prev = ramp
+	}
+}
@@ -2,7 +2,9 @@ package main
 
 import (
 	"context"
+	"crypto/rsa"
 	"errors"
+	"fmt"
 	"log/slog"
 	"net/http"
 	"os"
@@ -10,14 +12,20 @@ import (
 	"strconv"
 	"syscall"
 	"time"
+	_ "time/tzdata" // quota windows need zone data even on images without it
 
 	"http-load-balancer/api"
 	"http-load-balancer/balancer"
 	"http-load-balancer/configs"
 	"http-load-balancer/healthcheck"
+	"http-load-balancer/identity"
+	"http-load-balancer/lib/breaker"
+	"http-load-balancer/lib/conntrack"
 	"http-load-balancer/lib/logger/sl"
 	"http-load-balancer/lib/strategy"
 	"http-load-balancer/limiter"
+	"http-load-balancer/models"
+	"http-load-balancer/registry"
 	"http-load-balancer/repository"
 	"http-load-balancer/storage/postgres"
 )
@@ -46,6 +54,23 @@ func main() {
 
 	backendRepo := repository.NewBackendRepository(pgStorage.DB)
 	userRepo := repository.NewUserRepository(pgStorage.DB)
+	usageRepo := repository.NewUsageRepository(pgStorage.DB)
+	planRepo := repository.NewPlanRepository(pgStorage.DB)
+	healthEventRepo := repository.NewHealthEventRepository(pgStorage.DB)
+
+	// the default plan is only seeded, later edits through the API win
+	err = planRepo.CreateIfNotExists(&models.Plan{
+		Name:        limiter.DefaultPlan,
+		Capacity:    cfg.User.DefaultCapacity,
+		RatePerSec:  cfg.User.DefaultRPS,
+		WindowSec:   max(int(cfg.User.DefaultWindow.Seconds()), 1),
+		QuotaPeriod: limiter.QuotaPeriodMonth,
+	})
+	if err != nil {
+		log.Error("failed to create default plan", sl.Err(err))
+		os.Exit(1)
+	}
+	plans := limiter.NewPlanResolver(userRepo, planRepo, cfg.RateLimit.Shadow)
 
 	backends, err := backendRepo.GetAll()
 	if err != nil {
@@ -55,6 +80,12 @@ func main() {
 	if len(backends) == 0 {
 		for i := range len(cfg.Backends) {
 			cfg.Backends[i].IsAlive = true
+			if cfg.Backends[i].Weight <= 0 {
+				cfg.Backends[i].Weight = 1
+			}
+			if cfg.Backends[i].State == "" {
+				cfg.Backends[i].State = models.BackendEnabled
+			}
 			backend, err := backendRepo.Add(&cfg.Backends[i])
 			log.Debug("backend added", slog.Any("backend", backend))
 			if err != nil {
@@ -67,6 +98,15 @@ func main() {
 		}
 	}
 
+	backendRegistry := registry.New(backendRepo, cfg.BackendSync.Interval, log)
+	if err := backendRegistry.Load(); err != nil {
+		log.Error("failed to load backends", sl.Err(err))
+		os.Exit(1)
+	}
+	backendRegistry.Start()
+
+	conns := conntrack.New()
+
 	var balancerStrategy strategy.Strategy
 	switch cfg.Strategy {
 	case "round-robin":
@@ -76,36 +116,180 @@ func main() {
 		if err != nil {
 			log.Error("failed to get all backends", sl.Err(err))
 		}
-		balancerStrategy, err = strategy.NewLeastConnections(backends)
+		balancerStrategy, err = strategy.NewLeastConnections(backends, conns)
 		if err != nil {
 			log.Error("failed to get least connections", sl.Err(err))
 		}
 	case "random":
 		balancerStrategy = strategy.NewRandom()
+	case "weighted-round-robin":
+		balancerStrategy = strategy.NewWeightedRoundRobin()
+	case "consistent-hash":
+		keyFunc, err := strategy.NewKeyFunc(cfg.ConsistentHash.Key, cfg.ConsistentHash.Header)
+		if err != nil {
+			log.Error("invalid consistent hash config", sl.Err(err))
+			os.Exit(1)
+		}
+		balancerStrategy = strategy.NewConsistentHash(cfg.ConsistentHash.Replicas, keyFunc)
+	case "p2c-ewma":
+		balancerStrategy = strategy.NewP2CEWMA(conns, cfg.P2C.Decay)
 	default:
 		log.Info("Unknown strategy:", slog.String("strategy", cfg.Strategy))
 		os.Exit(1)
 	}
 	log.Info("balancer strategy", slog.String("strategy", cfg.Strategy))
 
-	limiter := limiter.NewTokenBucket(userRepo, cfg.User.DefaultCapacity, cfg.User.DefaultRPS)
+	apiKeys := identity.NewAPIKey(cfg.Identification.APIKey.Header, userRepo)
+	identifier, err := newClientIdentifier(cfg.Identification, apiKeys)
+	if err != nil {
+		log.Error("invalid identification config", sl.Err(err))
+		os.Exit(1)
+	}
+
+	quotaLocation, err := time.LoadLocation(cfg.Quota.Timezone)
+	if err != nil {
+		log.Error("invalid quota timezone", sl.Err(err))
+		os.Exit(1)
+	}
+	quotas := limiter.NewQuotas(plans, usageRepo, quotaLocation, cfg.Quota.FlushInterval, log)
+	quotas.Start()
+	shadow := limiter.NewShadowRecorder(cfg.RateLimit.ShadowRetention)
+	upstream := limiter.NewUpstream(
+		cfg.GlobalRateLimit.RPS,
+		cfg.GlobalRateLimit.Burst,
+		cfg.GlobalRateLimit.PriorityReserve,
+	)
+	concurrency := limiter.NewConcurrency(plans, cfg.Concurrency.MaxQueue, cfg.Concurrency.QueueTimeout)
 
-	healthchecker := healthcheck.NewHealthChecker(backendRepo, cfg.HealthCheckTimeout)
+	limiter := limiter.NewStore(
+		userRepo,
+		plans,
+		cfg.RateLimit.FlushInterval,
+		log,
+	)
+	limiter.Start()
+
+	probeOverrides := make(map[string]healthcheck.ProbeSettings, len(cfg.HealthCheck.Backends))
+	for url, probe := range cfg.HealthCheck.Backends {
+		probeOverrides[url] = probeSettings(probe)
+	}
+	probes, err := healthcheck.NewProbes(probeSettings(cfg.HealthCheck.Probe), probeOverrides)
+	if err != nil {
+		log.Error("invalid health check config", sl.Err(err))
+		os.Exit(1)
+	}
+	healthInterval := cfg.HealthCheck.Interval
+	if healthInterval <= 0 {
+		healthInterval = cfg.HealthCheckTimeout
+	}
+	healthEvents := healthcheck.NewEvents(
+		healthEventRepo,
+		cfg.HealthCheck.Webhooks,
+		cfg.HealthCheck.WebhookTimeout,
+		log,
+	)
+	healthchecker := healthcheck.NewHealthChecker(backendRegistry, probes, healthcheck.Schedule{
+		Interval:          healthInterval,
+		UnhealthyInterval: cfg.HealthCheck.UnhealthyInterval,
+		MaxBackoff:        cfg.HealthCheck.MaxBackoff,
+		Jitter:            cfg.HealthCheck.Jitter,
+		Rise:              cfg.HealthCheck.Rise,
+		Fall:              cfg.HealthCheck.Fall,
+	}, healthEvents, log)
+	outliers := healthcheck.NewOutlierDetector(
+		cfg.OutlierDetection.ConsecutiveErrors,
+		cfg.OutlierDetection.BaseEjectionTime,
+		cfg.OutlierDetection.MaxEjectionTime,
+		cfg.OutlierDetection.MaxEjectionPercent,
+	)
+	breakers := breaker.NewSet(breaker.Settings{
+		FailureRatio:   cfg.CircuitBreaker.FailureRatio,
+		MinRequests:    cfg.CircuitBreaker.MinRequests,
+		Interval:       cfg.CircuitBreaker.Interval,
+		OpenDuration:   cfg.CircuitBreaker.OpenDuration,
+		HalfOpenProbes: cfg.CircuitBreaker.HalfOpenProbes,
+	})
+
+	routeRules := make([]balancer.RouteRule, 0, len(cfg.Routes))
+	for _, route := range cfg.Routes {
+		cost := 1
+		if route.Cost != nil {
+			cost = *route.Cost
+		}
+		routeRules = append(routeRules, balancer.RouteRule{
+			Method:     route.Method,
+			Path:       route.Path,
+			Cost:       cost,
+			Bucket:     route.Bucket,
+			Capacity:   route.Capacity,
+			RatePerSec: route.RatePerSec,
+		})
+	}
+	routes, err := balancer.NewRoutes(routeRules)
+	if err != nil {
+		log.Error("invalid routes config", sl.Err(err))
+		os.Exit(1)
+	}
 
 	balancer := balancer.NewBalancer(
 		balancerStrategy,
-		backendRepo,
+		backendRegistry,
 		healthchecker,
+		identifier,
 		limiter,
+		quotas,
+		concurrency,
+		routes,
+		upstream,
+		shadow,
+		outliers,
+		breakers,
+		conns,
+		balancer.BodyPolicy{
+			MemoryLimit: cfg.Body.MemoryLimit,
+			MaxSize:     cfg.Body.MaxSize,
+		},
+		balancer.RetryPolicy{
+			MaxAttempts:   cfg.Retry.MaxAttempts,
+			Statuses:      cfg.Retry.Statuses,
+			PerTryTimeout: cfg.Retry.PerTryTimeout,
+			RetryPost:     cfg.Retry.RetryPost,
+			BudgetRatio:   cfg.Retry.BudgetRatio,
+			BudgetMin:     cfg.Retry.BudgetMin,
+		},
+		balancer.SlowStartPolicy{
+			Window:     cfg.SlowStart.Window,
+			MinWeight:  cfg.SlowStart.MinWeight,
+			Aggression: cfg.SlowStart.Aggression,
+		},
 		log,
 	)
 
-	clientHandler := api.NewClientHandler(userRepo)
+	clientHandler := api.NewClientHandler(userRepo, plans, limiter, quotas, concurrency, apiKeys)
+	planHandler := api.NewPlanHandler(planRepo, limiter, quotas, concurrency)
+	adminHandler := api.NewAdminHandler(backendRegistry, conns, shadow)
+	backendHandler := api.NewBackendHandler(backendRepo, backendRegistry, healthEventRepo, healthchecker, conns)
 	mux := http.NewServeMux()
 	mux.Handle("/", balancer)
 	mux.HandleFunc("POST /clients", clientHandler.CreateClient)
+	mux.HandleFunc("GET /clients/{client_id}", clientHandler.GetClient)
 	mux.HandleFunc("DELETE /clients/{client_id}", clientHandler.DeleteClient)
+	mux.HandleFunc("POST /clients/{client_id}/api-key", clientHandler.RotateAPIKey)
 	mux.HandleFunc("PATCH /clients/{client_id}", clientHandler.UpdateClientParams)
+	mux.HandleFunc("GET /clients/{client_id}/usage", clientHandler.GetClientUsage)
+	mux.HandleFunc("POST /plans", planHandler.CreatePlan)
+	mux.HandleFunc("GET /plans", planHandler.GetPlans)
+	mux.HandleFunc("GET /plans/{plan_id}", planHandler.GetPlan)
+	mux.HandleFunc("PATCH /plans/{plan_id}", planHandler.UpdatePlan)
+	mux.HandleFunc("DELETE /plans/{plan_id}", planHandler.DeletePlan)
+	mux.HandleFunc("GET /admin/connections", adminHandler.GetConnections)
+	mux.HandleFunc("GET /admin/backends", backendHandler.GetBackends)
+	mux.HandleFunc("POST /admin/backends", backendHandler.CreateBackend)
+	mux.HandleFunc("GET /admin/backends/{backend_id}", backendHandler.GetBackend)
+	mux.HandleFunc("PATCH /admin/backends/{backend_id}", backendHandler.UpdateBackend)
+	mux.HandleFunc("DELETE /admin/backends/{backend_id}", backendHandler.DeleteBackend)
+	mux.HandleFunc("GET /admin/backends/{backend_id}/health", backendHandler.GetBackendHealth)
+	mux.HandleFunc("GET /admin/shadow-report", adminHandler.GetShadowReport)
 
 	server := &http.Server{
 		Addr:           cfg.Addr + ":" + strconv.Itoa(cfg.Port),
@@ -148,5 +332,72 @@ func main() {
 		log.Error("Server shutdown error", sl.Err(err))
 	}
 
+	// flush rate limiter state only once no request can touch it anymore
+	limiter.Stop()
+	quotas.Stop()
+	backendRegistry.Stop()
+
 	log.Info("server stopped")
 }
+
+func newClientIdentifier(
+	cfg configs.Identification,
+	apiKeys *identity.APIKey,
+) (identity.ClientIdentifier, error) {
+	identifiers := make([]identity.ClientIdentifier, 0, len(cfg.Chain))
+	for _, name := range cfg.Chain {
+		switch name {
+		case "api_key":
+			identifiers = append(identifiers, apiKeys)
+		case "header":
+			identifiers = append(identifiers, identity.NewHeader(cfg.Header.Name))
+		case "jwt":
+			var rsaKey *rsa.PublicKey
+			if cfg.JWT.RS256PublicKey != "" {
+				key, err := identity.LoadRSAPublicKey(cfg.JWT.RS256PublicKey)
+				if err != nil {
+					return nil, err
+				}
+				rsaKey = key
+			}
+			jwt, err := identity.NewJWT(cfg.JWT.Header, cfg.JWT.Claim, []byte(cfg.JWT.HS256Secret), rsaKey)
+			if err != nil {
+				return nil, err
+			}
+			identifiers = append(identifiers, jwt)
+		case "ip":
+			networks := make(map[string]uint64, len(cfg.IP))
+			for _, rule := range cfg.IP {
+				networks[rule.CIDR] = rule.ClientID
+			}
+			cidr, err := identity.NewCIDR(networks)
+			if err != nil {
+				return nil, err
+			}
+			identifiers = append(identifiers, cidr)
+		case "body":
+			identifiers = append(identifiers, identity.NewBodyField(cfg.Body.Field))
+		default:
+			return nil, fmt.Errorf("unknown client identifier %q", name)
+		}
+	}
+	return identity.NewChain(cfg.Required, identifiers...), nil
+}
+
+func probeSettings(cfg configs.Probe) healthcheck.ProbeSettings {
+	return healthcheck.ProbeSettings{
+		Type:         cfg.Type,
+		Timeout:      cfg.Timeout,
+		Method:       cfg.Method,
+		Path:         cfg.Path,
+		Host:         cfg.Host,
+		Headers:      cfg.Headers,
+		Statuses:     cfg.Statuses,
+		BodyContains: cfg.BodyContains,
+		BodyRegex:    cfg.BodyRegex,
+		JSONPath:     cfg.JSONPath,
+		JSONValue:    cfg.JSONValue,
+		Service:      cfg.Service,
+		Command:      cfg.Command,
+	}
+}
@@ -19,8 +19,23 @@ type Config struct {
 	Postgres           PostgresConfig   `yaml:"postgres"                                       env-required:"true"`
 	Backends           []models.Backend `yaml:"hosts"                                          env-required:"true"`
 	HealthCheckTimeout time.Duration    `yaml:"healthcheck_timeout" env-default:"10s"`
+	HealthCheck        HealthCheck      `yaml:"health_check"`
 	Strategy           string           `yaml:"strategy"            env-default:"round-robbin"`
+	ConsistentHash     ConsistentHash   `yaml:"consistent_hash"`
+	P2C                P2C              `yaml:"p2c"`
+	OutlierDetection   OutlierDetection `yaml:"outlier_detection"`
+	CircuitBreaker     CircuitBreaker   `yaml:"circuit_breaker"`
+	Retry              Retry            `yaml:"retry"`
+	Body               Body             `yaml:"body"`
+	Identification     Identification   `yaml:"identification"`
 	User               User             `yaml:"user"`
+	RateLimit          RateLimit        `yaml:"rate_limit"`
+	Quota              Quota            `yaml:"quota"`
+	Concurrency        Concurrency      `yaml:"concurrency"`
+	Routes             []Route          `yaml:"routes"`
+	GlobalRateLimit    GlobalRateLimit  `yaml:"global_rate_limit"`
+	BackendSync        BackendSync      `yaml:"backend_sync"`
+	SlowStart          SlowStart        `yaml:"slow_start"`
 }
 
 type PostgresConfig struct {
@@ -32,9 +47,158 @@ type PostgresConfig struct {
 	Email    string `yaml:"email"    env-required:"false" env:"PGADMIN_EMAIL"`
 }
 
+type ConsistentHash struct {
+	Key      string `yaml:"key"      env-default:"client_id"`
+	Header   string `yaml:"header"`
+	Replicas int    `yaml:"replicas" env-default:"160"`
+}
+
+type P2C struct {
+	Decay time.Duration `yaml:"decay" env-default:"10s"`
+}
+
+type OutlierDetection struct {
+	ConsecutiveErrors  int           `yaml:"consecutive_errors"   env-default:"5"`
+	BaseEjectionTime   time.Duration `yaml:"base_ejection_time"   env-default:"30s"`
+	MaxEjectionTime    time.Duration `yaml:"max_ejection_time"    env-default:"5m"`
+	MaxEjectionPercent int           `yaml:"max_ejection_percent" env-default:"50"`
+}
+
+type CircuitBreaker struct {
+	FailureRatio   float64       `yaml:"failure_ratio"    env-default:"0.5"`
+	MinRequests    int           `yaml:"min_requests"     env-default:"20"`
+	Interval       time.Duration `yaml:"interval"         env-default:"10s"`
+	OpenDuration   time.Duration `yaml:"open_duration"    env-default:"30s"`
+	HalfOpenProbes int           `yaml:"half_open_probes" env-default:"3"`
+}
+
+type Retry struct {
+	MaxAttempts   int           `yaml:"max_attempts"    env-default:"3"`
+	Statuses      []int         `yaml:"statuses"        env-default:"502,503,504"`
+	PerTryTimeout time.Duration `yaml:"per_try_timeout" env-default:"15s"`
+	RetryPost     bool          `yaml:"retry_post"      env-default:"false"`
+	BudgetRatio   float64       `yaml:"budget_ratio"    env-default:"0.2"`
+	BudgetMin     int           `yaml:"budget_min"      env-default:"10"`
+}
+
+type Body struct {
+	MemoryLimit int64 `yaml:"memory_limit" env-default:"1048576"`
+	MaxSize     int64 `yaml:"max_size"     env-default:"33554432"`
+}
+
+type Identification struct {
+	Required bool             `yaml:"required" env-default:"true"`
+	Chain    []string         `yaml:"chain"    env-default:"body"`
+	APIKey   APIKeyIdentifier `yaml:"api_key"`
+	Header   HeaderIdentifier `yaml:"header"`
+	JWT      JWTIdentifier    `yaml:"jwt"`
+	IP       []IPIdentifier   `yaml:"ip"`
+	Body     BodyIdentifier   `yaml:"body"`
+}
+
+type APIKeyIdentifier struct {
+	Header string `yaml:"header" env-default:"X-API-Key"`
+}
+
+type HeaderIdentifier struct {
+	Name string `yaml:"name" env-default:"X-Client-ID"`
+}
+
+type JWTIdentifier struct {
+	Header         string `yaml:"header"           env-default:"Authorization"`
+	Claim          string `yaml:"claim"            env-default:"sub"`
+	HS256Secret    string `yaml:"hs256_secret"                                 env:"JWT_HS256_SECRET"`
+	RS256PublicKey string `yaml:"rs256_public_key"`
+}
+
+type IPIdentifier struct {
+	CIDR     string `yaml:"cidr"`
+	ClientID uint64 `yaml:"client_id"`
+}
+
+type BodyIdentifier struct {
+	Field string `yaml:"field" env-default:"client_id"`
+}
+
 type User struct {
-	DefaultCapacity int `yaml:"default_capacity" env-default:"100"`
-	DefaultRPS      int `yaml:"default_RPS"      env-default:"10"`
+	DefaultCapacity int           `yaml:"default_capacity" env-default:"100"`
+	DefaultRPS      int           `yaml:"default_RPS"      env-default:"10"`
+	DefaultWindow   time.Duration `yaml:"default_window"   env-default:"10s"`
+}
+
+type RateLimit struct {
+	FlushInterval   time.Duration `yaml:"flush_interval"   env-default:"5s"`
+	Shadow          bool          `yaml:"shadow"           env-default:"false"`
+	ShadowRetention time.Duration `yaml:"shadow_retention" env-default:"24h"`
+}
+
+type Quota struct {
+	Timezone      string        `yaml:"timezone"       env-default:"UTC"`
+	FlushInterval time.Duration `yaml:"flush_interval" env-default:"5s"`
+}
+
+type Concurrency struct {
+	MaxQueue     int           `yaml:"max_queue"     env-default:"0"`
+	QueueTimeout time.Duration `yaml:"queue_timeout" env-default:"1s"`
+}
+
+type HealthCheck struct {
+	Probe `yaml:",inline"`
+	// Interval defaults to healthcheck_timeout, which it replaces.
+	Interval          time.Duration `yaml:"interval"`
+	UnhealthyInterval time.Duration `yaml:"unhealthy_interval"`
+	MaxBackoff        time.Duration `yaml:"max_backoff"`
+	Jitter            float64       `yaml:"jitter"             env-default:"0.1"`
+	Rise              int           `yaml:"rise"               env-default:"2"`
+	Fall              int           `yaml:"fall"               env-default:"3"`
+	// Webhooks get a POST on every backend going down or up.
+	Webhooks       []string      `yaml:"webhooks"`
+	WebhookTimeout time.Duration `yaml:"webhook_timeout" env-default:"5s"`
+	// Backends override the probe per backend URL, field by field.
+	Backends map[string]Probe `yaml:"backends"`
+}
+
+type Probe struct {
+	Type         string            `yaml:"type"`
+	Timeout      time.Duration     `yaml:"timeout"`
+	Method       string            `yaml:"method"`
+	Path         string            `yaml:"path"`
+	Host         string            `yaml:"host"`
+	Headers      map[string]string `yaml:"headers"`
+	Statuses     []string          `yaml:"statuses"`
+	BodyContains string            `yaml:"body_contains"`
+	BodyRegex    string            `yaml:"body_regex"`
+	JSONPath     string            `yaml:"json_path"`
+	JSONValue    string            `yaml:"json_value"`
+	Service      string            `yaml:"service"`
+	Command      []string          `yaml:"command"`
+}
+
+type SlowStart struct {
+	Window     time.Duration `yaml:"window"     env-default:"0s"`
+	MinWeight  float64       `yaml:"min_weight" env-default:"0.1"`
+	Aggression float64       `yaml:"aggression" env-default:"1"`
+}
+
+type BackendSync struct {
+	Interval time.Duration `yaml:"interval" env-default:"5s"`
+}
+
+type GlobalRateLimit struct {
+	RPS             int     `yaml:"rps"              env-default:"0"`
+	Burst           int     `yaml:"burst"            env-default:"0"`
+	PriorityReserve float64 `yaml:"priority_reserve" env-default:"0"`
+}
+
+// Route prices requests to a path. Cost is 1 when left out; an explicit 0
+// is rejected.
+type Route struct {
+	Method     string `yaml:"method"`
+	Path       string `yaml:"path"`
+	Cost       *int   `yaml:"cost"`
+	Bucket     string `yaml:"bucket"`
+	Capacity   int    `yaml:"capacity"`
+	RatePerSec int    `yaml:"rate_per_sec"`
 }
 
 func MustLoad() *Config {
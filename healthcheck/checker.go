@@ -2,39 +2,50 @@ package healthcheck
 
 import (
 	"context"
-	"net/http"
-	"net/url"
+	"errors"
+	"fmt"
+	"log/slog"
 	"sync"
 	"time"
 
+	"http-load-balancer/lib/logger/sl"
 	"http-load-balancer/models"
-	"http-load-balancer/repository"
+	"http-load-balancer/registry"
 )
 
+// schedulerTick is how often the checker looks for backends due a check.
+const schedulerTick = 100 * time.Millisecond
+
+// HealthChecker actively probes backends and marks them up or down in the
+// registry once enough checks in a row agree.
 type HealthChecker struct {
-	repo       repository.BackendRepository
-	httpClient *http.Client
-	interval   time.Duration
-	stopChan   chan struct{}
-	wg         sync.WaitGroup
+	registry *registry.Registry
+	probes   *Probes
+	schedule Schedule
+	events   *Events
+	log      *slog.Logger
+
+	mu     sync.Mutex
+	states map[uint64]*probeState
+
+	stopChan chan struct{}
+	wg       sync.WaitGroup
 }
 
-func NewHealthChecker(repo repository.BackendRepository, interval time.Duration) *HealthChecker {
-	transport := &http.Transport{
-		MaxIdleConns:          2000,
-		MaxIdleConnsPerHost:   1000,
-		IdleConnTimeout:       90 * time.Second,
-		TLSHandshakeTimeout:   10 * time.Second,
-		ExpectContinueTimeout: 1 * time.Second,
-		DisableKeepAlives:     false,
-	}
+func NewHealthChecker(
+	registry *registry.Registry,
+	probes *Probes,
+	schedule Schedule,
+	events *Events,
+	log *slog.Logger,
+) *HealthChecker {
 	return &HealthChecker{
-		repo: repo,
-		httpClient: &http.Client{
-			Timeout:   time.Second,
-			Transport: transport,
-		},
-		interval: interval,
+		registry: registry,
+		probes:   probes,
+		schedule: schedule.withDefaults(),
+		events:   events,
+		log:      log,
+		states:   make(map[uint64]*probeState),
 		stopChan: make(chan struct{}),
 	}
 }
@@ -47,65 +58,146 @@ func (hc *HealthChecker) Start() {
 func (hc *HealthChecker) Stop() {
 	close(hc.stopChan)
 	hc.wg.Wait()
+	hc.events.Stop()
 }
 
 func (hc *HealthChecker) run() {
 	defer hc.wg.Done()
 
-	hc.checkAllBackends()
-
-	ticker := time.NewTicker(hc.interval)
+	ticker := time.NewTicker(schedulerTick)
 	defer ticker.Stop()
 
 	for {
+		hc.checkDueBackends()
 		select {
 		case <-ticker.C:
-			hc.checkAllBackends()
 		case <-hc.stopChan:
 			return
 		}
 	}
 }
 
-func (hc *HealthChecker) checkAllBackends() {
-	backends, err := hc.repo.GetAll()
-	if err != nil {
-		return
-	}
+// checkDueBackends starts checks of the backends whose time has come.
+// Every backend runs on its own schedule, see Schedule.
+func (hc *HealthChecker) checkDueBackends() {
+	now := time.Now()
+	backends := hc.registry.All()
 
-	var wg sync.WaitGroup
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+
+	known := make(map[uint64]struct{}, len(backends))
 	for _, b := range backends {
-		wg.Add(1)
+		// manually disabled backends are left alone until re-enabled,
+		// and then checked from scratch
+		if b.State == models.BackendDisabled {
+			continue
+		}
+		known[b.ID] = struct{}{}
+
+		st, ok := hc.states[b.ID]
+		if !ok {
+			st = &probeState{next: now.Add(hc.schedule.firstDelay())}
+			hc.states[b.ID] = st
+		}
+		if st.inFlight || now.Before(st.next) {
+			continue
+		}
+		st.inFlight = true
+		hc.wg.Add(1)
 		go func(backend models.Backend) {
-			defer wg.Done()
+			defer hc.wg.Done()
 			hc.checkBackend(backend)
 		}(b)
 	}
-	wg.Wait()
+	for id, st := range hc.states {
+		if _, ok := known[id]; !ok && !st.inFlight {
+			delete(hc.states, id)
+		}
+	}
 }
 
 func (hc *HealthChecker) checkBackend(backend models.Backend) {
-	url, err := url.Parse("http://" + backend.URL + "/health")
+	started := time.Now()
+	err := hc.probe(backend)
+	latency := time.Since(started)
 	if err != nil {
-		return
+		hc.log.Debug("backend failed health check",
+			sl.Err(err),
+			slog.Uint64("backend_id", backend.ID))
 	}
 
-	ctx := context.Background()
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url.String(), nil)
-	if err != nil {
-		return
+	// health may have been changed meanwhile, e.g. by a registry reload
+	if current, ok := hc.registry.Get(backend.ID); ok {
+		backend = current
 	}
 
-	isAlive := true
-	resp, err := hc.httpClient.Do(req)
+	event := models.HealthEvent{
+		BackendID: backend.ID,
+		IsAlive:   err == nil,
+		Reason:    failureReason(err),
+		LatencyMS: latency.Milliseconds(),
+		CreatedAt: started,
+	}
 	if err != nil {
-		isAlive = false
+		event.Error = err.Error()
+	}
+
+	hc.mu.Lock()
+	st := hc.states[backend.ID]
+	st.last = event
+	isAlive := backend.IsAlive
+	changed := hc.schedule.record(st, isAlive, err == nil)
+	if changed {
+		isAlive = event.IsAlive
+		hc.registry.SetIsAlive(backend.ID, isAlive)
+	}
+	st.next = time.Now().Add(hc.schedule.delay(st, isAlive))
+	st.inFlight = false
+	hc.mu.Unlock()
+
+	if changed {
+		hc.events.Record(backend, event)
 	}
-	defer resp.Body.Close()
+}
+
+// probe runs backend's health check within its timeout.
+func (hc *HealthChecker) probe(backend models.Backend) error {
+	probe := hc.probes.lookup(backend.URL)
+
+	ctx, cancel := context.WithTimeout(context.Background(), probe.timeout)
+	defer cancel()
+	err := probe.prober.Probe(ctx, backend)
+	// probes that don't fail with the context's error themselves, like a
+	// killed command, still count as timed out
+	if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) && !errors.Is(err, context.DeadlineExceeded) {
+		err = fmt.Errorf("%w: %w", context.DeadlineExceeded, err)
+	}
+	return err
+}
+
+// Status is the outcome of a backend's latest check and where it stands
+// towards being marked up or down.
+type Status struct {
+	LastCheck            models.HealthEvent `json:"last_check"`
+	ConsecutiveSuccesses int                `json:"consecutive_successes"`
+	ConsecutiveFailures  int                `json:"consecutive_failures"`
+	NextCheck            time.Time          `json:"next_check"`
+}
 
-	isAlive = isAlive && resp.StatusCode == http.StatusOK
+// Status reports false for backends that haven't been checked yet.
+func (hc *HealthChecker) Status(backendID uint64) (Status, bool) {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
 
-	if _, err = hc.repo.SetIsAlive(backend.ID, isAlive); err != nil {
-		return
+	st, ok := hc.states[backendID]
+	if !ok || st.last.CreatedAt.IsZero() {
+		return Status{}, false
 	}
+	return Status{
+		LastCheck:            st.last,
+		ConsecutiveSuccesses: st.successes,
+		ConsecutiveFailures:  st.failures,
+		NextCheck:            st.next,
+	}, true
 }
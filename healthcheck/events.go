@@ -0,0 +1,175 @@
+package healthcheck
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+
+	"http-load-balancer/lib/logger/sl"
+	"http-load-balancer/models"
+	"http-load-balancer/repository"
+)
+
+// Reasons recorded for a check, besides status_<code> for unexpected HTTP
+// statuses. The error itself goes to the event's Error.
+const (
+	ReasonPassed            = "passed"
+	ReasonTimeout           = "timeout"
+	ReasonConnectionRefused = "connection_refused"
+	ReasonDNS               = "dns"
+	ReasonBodyMismatch      = "body_mismatch"
+	ReasonExecFailed        = "exec_failed"
+	ReasonError             = "error"
+)
+
+var (
+	errBodyMismatch = errors.New("unexpected body")
+	errExecFailed   = errors.New("command failed")
+)
+
+// StatusError is a probe response with a status a healthy backend doesn't
+// answer with.
+type StatusError struct {
+	Code int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("unexpected status %d", e.Code)
+}
+
+// failureReason classifies the outcome of a check.
+func failureReason(err error) string {
+	var statusErr *StatusError
+	var dnsErr *net.DNSError
+	switch {
+	case err == nil:
+		return ReasonPassed
+	case errors.Is(err, context.DeadlineExceeded) || os.IsTimeout(err):
+		return ReasonTimeout
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return ReasonConnectionRefused
+	case errors.As(err, &statusErr):
+		return fmt.Sprintf("status_%d", statusErr.Code)
+	case errors.As(err, &dnsErr):
+		return ReasonDNS
+	case errors.Is(err, errBodyMismatch):
+		return ReasonBodyMismatch
+	case errors.Is(err, errExecFailed):
+		return ReasonExecFailed
+	default:
+		return ReasonError
+	}
+}
+
+// Events reports backends going down or up: as a log line, as a row in
+// the health history and as a POST to every webhook. The history and the
+// webhooks are written in the background so a slow DB or receiver never
+// delays health checks.
+type Events struct {
+	repo     repository.HealthEventRepository
+	webhooks []string
+	client   *http.Client
+	log      *slog.Logger
+	wg       sync.WaitGroup
+}
+
+func NewEvents(
+	repo repository.HealthEventRepository,
+	webhooks []string,
+	webhookTimeout time.Duration,
+	log *slog.Logger,
+) *Events {
+	return &Events{
+		repo:     repo,
+		webhooks: webhooks,
+		client:   &http.Client{Timeout: webhookTimeout},
+		log:      log,
+	}
+}
+
+// webhookPayload is the body POSTed to webhooks.
+type webhookPayload struct {
+	BackendID uint64    `json:"backend_id"`
+	URL       string    `json:"url"`
+	IsAlive   bool      `json:"is_alive"`
+	Reason    string    `json:"reason"`
+	Error     string    `json:"error,omitempty"`
+	LatencyMS int64     `json:"latency_ms"`
+	Time      time.Time `json:"time"`
+}
+
+func (e *Events) Record(backend models.Backend, event models.HealthEvent) {
+	attrs := []any{
+		slog.Uint64("backend_id", backend.ID),
+		slog.String("url", backend.URL),
+		slog.String("reason", event.Reason),
+		slog.Int64("latency_ms", event.LatencyMS),
+	}
+	if event.IsAlive {
+		e.log.Info("backend is up", attrs...)
+	} else {
+		e.log.Warn("backend is down", append(attrs, slog.String("error", event.Error))...)
+	}
+
+	e.wg.Add(1)
+	go func(event models.HealthEvent) {
+		defer e.wg.Done()
+		if err := e.repo.Add(&event); err != nil {
+			e.log.Error("failed to store health event",
+				sl.Err(err),
+				slog.Uint64("backend_id", backend.ID))
+		}
+	}(event)
+
+	if len(e.webhooks) == 0 {
+		return
+	}
+	body, err := json.Marshal(webhookPayload{
+		BackendID: backend.ID,
+		URL:       backend.URL,
+		IsAlive:   event.IsAlive,
+		Reason:    event.Reason,
+		Error:     event.Error,
+		LatencyMS: event.LatencyMS,
+		Time:      event.CreatedAt,
+	})
+	if err != nil {
+		e.log.Error("failed to encode health event", sl.Err(err))
+		return
+	}
+	for _, webhook := range e.webhooks {
+		e.wg.Add(1)
+		go func(webhook string) {
+			defer e.wg.Done()
+			e.notify(webhook, body)
+		}(webhook)
+	}
+}
+
+func (e *Events) notify(webhook string, body []byte) {
+	resp, err := e.client.Post(webhook, "application/json", bytes.NewReader(body))
+	if err != nil {
+		e.log.Error("health webhook failed", sl.Err(err), slog.String("webhook", webhook))
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		e.log.Error("health webhook failed",
+			slog.String("webhook", webhook),
+			slog.Int("status", resp.StatusCode))
+	}
+}
+
+// Stop waits for history writes and webhooks in progress.
+func (e *Events) Stop() {
+	e.wg.Wait()
+}
@@ -0,0 +1,36 @@
+package healthcheck
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+)
+
+func TestFailureReason(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{"passed", nil, ReasonPassed},
+		{"timeout", fmt.Errorf("%w: signal: killed", context.DeadlineExceeded), ReasonTimeout},
+		{"os timeout", os.ErrDeadlineExceeded, ReasonTimeout},
+		{"refused", &net.OpError{Op: "dial", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}, ReasonConnectionRefused},
+		{"status", &StatusError{Code: 503}, "status_503"},
+		{"dns", &net.OpError{Op: "dial", Err: &net.DNSError{Err: "no such host", Name: "backend1"}}, ReasonDNS},
+		{"body", fmt.Errorf("%w: no %q", errBodyMismatch, "status"), ReasonBodyMismatch},
+		{"exec", fmt.Errorf("%w: exit status 1", errExecFailed), ReasonExecFailed},
+		{"other", errors.New("malformed grpc response with a very long explanation"), ReasonError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := failureReason(tt.err); got != tt.want {
+				t.Fatalf("failureReason() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
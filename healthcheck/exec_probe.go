@@ -0,0 +1,54 @@
+package healthcheck
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"http-load-balancer/models"
+)
+
+// execWaitDelay is how long a timed out command gets after it was killed
+// before its output is abandoned, e.g. to a child it left behind.
+const execWaitDelay = time.Second
+
+// execProber runs a local command; the backend is healthy if it exits
+// with code 0. A command that runs out of time is killed together with
+// everything it started.
+type execProber struct {
+	command []string
+}
+
+func newExecProber(command []string) (*execProber, error) {
+	if len(command) == 0 {
+		return nil, errors.New("exec health check needs a command")
+	}
+	return &execProber{command: command}, nil
+}
+
+func (p *execProber) Probe(ctx context.Context, backend models.Backend) error {
+	cmd := exec.CommandContext(ctx, p.command[0], p.command[1:]...)
+	cmd.Env = append(os.Environ(),
+		"BACKEND_ID="+strconv.FormatUint(backend.ID, 10),
+		"BACKEND_URL="+backend.URL,
+	)
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	cmd.WaitDelay = execWaitDelay
+	killProcessGroup(cmd)
+
+	if err := cmd.Run(); err != nil {
+		if out := strings.TrimSpace(output.String()); out != "" {
+			return fmt.Errorf("%w: %w: %.200s", errExecFailed, err, out)
+		}
+		return fmt.Errorf("%w: %w", errExecFailed, err)
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+//go:build unix
+
+package healthcheck
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"testing"
+	"time"
+
+	"http-load-balancer/models"
+)
+
+func TestExecProbe(t *testing.T) {
+	tests := []struct {
+		name    string
+		command []string
+		reason  string
+	}{
+		{name: "healthy", command: []string{"sh", "-c", `test "$BACKEND_URL" = backend1:8080`}, reason: ReasonPassed},
+		{name: "exit code", command: []string{"sh", "-c", "echo down; exit 2"}, reason: ReasonExecFailed},
+		{name: "missing command", command: []string{"/nonexistent/check"}, reason: ReasonExecFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := newExecProber(tt.command)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = p.Probe(context.Background(), models.Backend{ID: 1, URL: "backend1:8080"})
+			if got := failureReason(err); got != tt.reason {
+				t.Fatalf("reason = %q (%v), want %q", got, err, tt.reason)
+			}
+		})
+	}
+}
+
+func TestExecProbeKillsChildren(t *testing.T) {
+	p, err := newExecProber([]string{"sh", "-c", "sleep 30 & sleep 30"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	err = p.Probe(ctx, models.Backend{ID: 1})
+	// the background sleep holds on to the output; unless it is killed too
+	// the probe waits for execWaitDelay
+	if took := time.Since(start); took >= execWaitDelay {
+		t.Fatalf("probe took %v", took)
+	}
+	if err == nil || errors.Is(err, exec.ErrWaitDelay) {
+		t.Fatalf("err = %v", err)
+	}
+}
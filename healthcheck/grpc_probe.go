@@ -0,0 +1,151 @@
+package healthcheck
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"http-load-balancer/models"
+)
+
+// grpcServing is HealthCheckResponse.ServingStatus SERVING.
+const grpcServing = 1
+
+// grpcProber calls grpc.health.v1.Health/Check over plaintext HTTP/2. The
+// protocol is small enough to speak without the gRPC libraries: one
+// length-prefixed protobuf message each way with the status in the
+// trailers.
+type grpcProber struct {
+	client  *http.Client
+	request []byte // framed HealthCheckRequest
+}
+
+func newGRPCProber(service string) *grpcProber {
+	// HealthCheckRequest{service = 1}
+	var msg []byte
+	if service != "" {
+		msg = append([]byte{0x0a}, binary.AppendUvarint(nil, uint64(len(service)))...)
+		msg = append(msg, service...)
+	}
+
+	protocols := new(http.Protocols)
+	protocols.SetUnencryptedHTTP2(true)
+	return &grpcProber{
+		client: &http.Client{
+			Transport: &http.Transport{Protocols: protocols},
+		},
+		request: grpcFrame(msg),
+	}
+}
+
+func (p *grpcProber) Probe(ctx context.Context, backend models.Backend) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost,
+		"http://"+backend.URL+"/grpc.health.v1.Health/Check", bytes.NewReader(p.request))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("TE", "trailers")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return &StatusError{Code: resp.StatusCode}
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxProbeBody))
+	if err != nil {
+		return err
+	}
+
+	// errors come as a trailers-only response, with grpc-status in the headers
+	status := resp.Trailer.Get("Grpc-Status")
+	if status == "" {
+		status = resp.Header.Get("Grpc-Status")
+	}
+	if status != "0" {
+		msg := resp.Trailer.Get("Grpc-Message")
+		if msg == "" {
+			msg = resp.Header.Get("Grpc-Message")
+		}
+		return fmt.Errorf("grpc status %s: %s", status, msg)
+	}
+
+	serving, err := grpcServingStatus(body)
+	if err != nil {
+		return err
+	}
+	if serving != grpcServing {
+		return fmt.Errorf("serving status %d", serving)
+	}
+	return nil
+}
+
+func grpcFrame(msg []byte) []byte {
+	frame := make([]byte, 5, 5+len(msg))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(msg)))
+	return append(frame, msg...)
+}
+
+// grpcServingStatus decodes HealthCheckResponse{status = 1} from a framed
+// message. A missing field is UNKNOWN (0).
+func grpcServingStatus(body []byte) (uint64, error) {
+	if len(body) < 5 {
+		return 0, errors.New("short grpc response")
+	}
+	if body[0] != 0 {
+		return 0, errors.New("compressed grpc response")
+	}
+	size := binary.BigEndian.Uint32(body[1:5])
+	if uint32(len(body)-5) < size {
+		return 0, errors.New("short grpc response")
+	}
+	msg := body[5 : 5+size]
+
+	var status uint64
+	for len(msg) > 0 {
+		key, n := binary.Uvarint(msg)
+		if n <= 0 {
+			return 0, errors.New("malformed grpc response")
+		}
+		msg = msg[n:]
+
+		switch key & 7 {
+		case 0: // varint
+			v, n := binary.Uvarint(msg)
+			if n <= 0 {
+				return 0, errors.New("malformed grpc response")
+			}
+			msg = msg[n:]
+			if key>>3 == 1 {
+				status = v
+			}
+		case 2: // length-delimited
+			l, n := binary.Uvarint(msg)
+			if n <= 0 || uint64(len(msg)-n) < l {
+				return 0, errors.New("malformed grpc response")
+			}
+			msg = msg[n+int(l):]
+		case 1: // 64-bit
+			if len(msg) < 8 {
+				return 0, errors.New("malformed grpc response")
+			}
+			msg = msg[8:]
+		case 5: // 32-bit
+			if len(msg) < 4 {
+				return 0, errors.New("malformed grpc response")
+			}
+			msg = msg[4:]
+		default:
+			return 0, fmt.Errorf("unsupported wire type %d", key&7)
+		}
+	}
+	return status, nil
+}
@@ -0,0 +1,237 @@
+package healthcheck
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"http-load-balancer/models"
+)
+
+// maxProbeBody is how much of a response body is read for matching.
+const maxProbeBody = 64 << 10
+
+func newHTTPClient() *http.Client {
+	transport := &http.Transport{
+		MaxIdleConns:          2000,
+		MaxIdleConnsPerHost:   1000,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+		DisableKeepAlives:     false,
+	}
+	// timeouts are per probe
+	return &http.Client{
+		Transport: transport,
+		// a redirect is judged by its own status like any other response
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+type statusRange struct {
+	from, to int
+}
+
+// httpProber sends a request and matches the response against what a
+// healthy backend answers.
+type httpProber struct {
+	client       *http.Client
+	method       string
+	path         string
+	host         string
+	headers      http.Header
+	statuses     []statusRange
+	bodyContains string
+	bodyRegex    *regexp.Regexp
+	jsonPath     []string
+	jsonValue    string
+}
+
+// newHTTPProber validates settings: GET /health expecting 200 unless told
+// otherwise.
+func newHTTPProber(settings ProbeSettings, client *http.Client) (*httpProber, error) {
+	p := &httpProber{
+		client:       client,
+		method:       strings.ToUpper(settings.Method),
+		path:         settings.Path,
+		host:         settings.Host,
+		headers:      make(http.Header, len(settings.Headers)),
+		bodyContains: settings.BodyContains,
+		jsonValue:    settings.JSONValue,
+	}
+	if p.method == "" {
+		p.method = http.MethodGet
+	}
+	if p.path == "" {
+		p.path = "/health"
+	}
+	if !strings.HasPrefix(p.path, "/") {
+		return nil, fmt.Errorf("health check path %q must start with /", p.path)
+	}
+	for k, v := range settings.Headers {
+		p.headers.Set(k, v)
+	}
+
+	if len(settings.Statuses) == 0 {
+		p.statuses = []statusRange{{http.StatusOK, http.StatusOK}}
+	}
+	for _, spec := range settings.Statuses {
+		r, err := parseStatusRange(spec)
+		if err != nil {
+			return nil, err
+		}
+		p.statuses = append(p.statuses, r)
+	}
+
+	if settings.BodyRegex != "" {
+		re, err := regexp.Compile(settings.BodyRegex)
+		if err != nil {
+			return nil, fmt.Errorf("invalid health check body_regex: %w", err)
+		}
+		p.bodyRegex = re
+	}
+	if settings.JSONPath != "" {
+		path := strings.TrimPrefix(strings.TrimPrefix(settings.JSONPath, "$"), ".")
+		if path == "" {
+			return nil, fmt.Errorf("invalid health check json_path %q", settings.JSONPath)
+		}
+		p.jsonPath = strings.Split(path, ".")
+	}
+	return p, nil
+}
+
+func parseStatusRange(spec string) (statusRange, error) {
+	from, to, isRange := strings.Cut(strings.TrimSpace(spec), "-")
+	lo, err := strconv.Atoi(strings.TrimSpace(from))
+	if err != nil {
+		return statusRange{}, fmt.Errorf("invalid health check status %q", spec)
+	}
+	hi := lo
+	if isRange {
+		hi, err = strconv.Atoi(strings.TrimSpace(to))
+		if err != nil {
+			return statusRange{}, fmt.Errorf("invalid health check status %q", spec)
+		}
+	}
+	if lo < 100 || hi > 599 || lo > hi {
+		return statusRange{}, fmt.Errorf("invalid health check status %q", spec)
+	}
+	return statusRange{lo, hi}, nil
+}
+
+// needsBody reports whether the response body takes part in the check.
+func (p *httpProber) needsBody() bool {
+	return p.bodyContains != "" || p.bodyRegex != nil || p.jsonPath != nil
+}
+
+// check reports why a response is unhealthy, or nil if it is healthy.
+func (p *httpProber) check(status int, body []byte) error {
+	accepted := false
+	for _, r := range p.statuses {
+		if status >= r.from && status <= r.to {
+			accepted = true
+			break
+		}
+	}
+	if !accepted {
+		return &StatusError{Code: status}
+	}
+
+	if p.bodyContains != "" && !bytes.Contains(body, []byte(p.bodyContains)) {
+		return fmt.Errorf("%w: does not contain %q", errBodyMismatch, p.bodyContains)
+	}
+	if p.bodyRegex != nil && !p.bodyRegex.Match(body) {
+		return fmt.Errorf("%w: does not match %q", errBodyMismatch, p.bodyRegex)
+	}
+	if p.jsonPath != nil {
+		return p.checkJSON(body)
+	}
+	return nil
+}
+
+func (p *httpProber) checkJSON(body []byte) error {
+	path := strings.Join(p.jsonPath, ".")
+
+	var v any
+	if err := json.Unmarshal(body, &v); err != nil {
+		return fmt.Errorf("%w: not JSON: %w", errBodyMismatch, err)
+	}
+	for _, key := range p.jsonPath {
+		switch node := v.(type) {
+		case map[string]any:
+			next, ok := node[key]
+			if !ok {
+				return fmt.Errorf("%w: no %q", errBodyMismatch, path)
+			}
+			v = next
+		case []any:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(node) {
+				return fmt.Errorf("%w: no %q", errBodyMismatch, path)
+			}
+			v = node[i]
+		default:
+			return fmt.Errorf("%w: no %q", errBodyMismatch, path)
+		}
+	}
+
+	if p.jsonValue == "" {
+		return nil
+	}
+	got, ok := v.(string)
+	if !ok {
+		raw, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		got = string(raw)
+	}
+	if got != p.jsonValue {
+		return fmt.Errorf("%w: %s is %q, want %q", errBodyMismatch, path, got, p.jsonValue)
+	}
+	return nil
+}
+
+func (p *httpProber) Probe(ctx context.Context, backend models.Backend) error {
+	url, err := url.Parse("http://" + backend.URL + p.path)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, p.method, url.String(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header = p.headers.Clone()
+	if p.host != "" {
+		req.Host = p.host
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var body []byte
+	if p.needsBody() {
+		body, err = io.ReadAll(io.LimitReader(resp.Body, maxProbeBody))
+		if err != nil {
+			return err
+		}
+	}
+	// drain what's left so the connection can be reused
+	io.Copy(io.Discard, io.LimitReader(resp.Body, maxProbeBody))
+
+	return p.check(resp.StatusCode, body)
+}
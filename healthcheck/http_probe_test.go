@@ -0,0 +1,98 @@
+package healthcheck
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"http-load-balancer/models"
+)
+
+func TestHTTPProberCheck(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings ProbeSettings
+		status   int
+		body     string
+		reason   string
+	}{
+		{name: "default 200", status: 200, reason: ReasonPassed},
+		{name: "default rejects 204", status: 204, reason: "status_204"},
+		{name: "range", settings: ProbeSettings{Statuses: []string{"200-299"}}, status: 204, reason: ReasonPassed},
+		{name: "outside range", settings: ProbeSettings{Statuses: []string{"200-299", "404"}}, status: 301, reason: "status_301"},
+		{name: "single extra code", settings: ProbeSettings{Statuses: []string{"200-299", "404"}}, status: 404, reason: ReasonPassed},
+		{name: "contains", settings: ProbeSettings{BodyContains: "ok"}, status: 200, body: "all ok", reason: ReasonPassed},
+		{name: "missing text", settings: ProbeSettings{BodyContains: "ok"}, status: 200, body: "degraded", reason: ReasonBodyMismatch},
+		{name: "regex", settings: ProbeSettings{BodyRegex: `^up( |$)`}, status: 200, body: "up since 3d", reason: ReasonPassed},
+		{name: "regex mismatch", settings: ProbeSettings{BodyRegex: `^up( |$)`}, status: 200, body: "upgrading", reason: ReasonBodyMismatch},
+		{name: "json value", settings: ProbeSettings{JSONPath: "$.status", JSONValue: "ok"}, status: 200, body: `{"status":"ok"}`, reason: ReasonPassed},
+		{name: "json wrong value", settings: ProbeSettings{JSONPath: "status", JSONValue: "ok"}, status: 200, body: `{"status":"down"}`, reason: ReasonBodyMismatch},
+		{name: "json array index", settings: ProbeSettings{JSONPath: "checks.1.up", JSONValue: "true"}, status: 200, body: `{"checks":[{"up":false},{"up":true}]}`, reason: ReasonPassed},
+		{name: "json path exists", settings: ProbeSettings{JSONPath: "db"}, status: 200, body: `{"db":null}`, reason: ReasonPassed},
+		{name: "json missing path", settings: ProbeSettings{JSONPath: "db"}, status: 200, body: `{}`, reason: ReasonBodyMismatch},
+		{name: "not json", settings: ProbeSettings{JSONPath: "db"}, status: 200, body: "ok", reason: ReasonBodyMismatch},
+		{name: "status checked before body", settings: ProbeSettings{BodyContains: "ok"}, status: 500, body: "ok", reason: "status_500"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := newHTTPProber(tt.settings, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = p.check(tt.status, []byte(tt.body))
+			if got := failureReason(err); got != tt.reason {
+				t.Fatalf("reason = %q (%v), want %q", got, err, tt.reason)
+			}
+		})
+	}
+}
+
+func TestNewHTTPProberRejectsInvalidSettings(t *testing.T) {
+	tests := []ProbeSettings{
+		{Path: "health"},
+		{Statuses: []string{"abc"}},
+		{Statuses: []string{"299-200"}},
+		{Statuses: []string{"600"}},
+		{BodyRegex: "("},
+		{JSONPath: "$"},
+	}
+	for _, settings := range tests {
+		if _, err := newHTTPProber(settings, nil); err == nil {
+			t.Errorf("newHTTPProber(%+v) accepted invalid settings", settings)
+		}
+	}
+}
+
+func TestHTTPProberProbe(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodHead || r.URL.Path != "/ready" || r.Host != "api.internal" ||
+			r.Header.Get("X-Probe") != "1" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	p, err := newHTTPProber(ProbeSettings{
+		Method:   "head",
+		Path:     "/ready",
+		Host:     "api.internal",
+		Headers:  map[string]string{"X-Probe": "1"},
+		Statuses: []string{"204"},
+	}, newHTTPClient())
+	if err != nil {
+		t.Fatal(err)
+	}
+	backend := models.Backend{ID: 1, URL: strings.TrimPrefix(server.URL, "http://")}
+	if err := p.Probe(context.Background(), backend); err != nil {
+		var statusErr *StatusError
+		if errors.As(err, &statusErr) {
+			t.Fatalf("request not built from the settings: got status %d", statusErr.Code)
+		}
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,147 @@
+package healthcheck
+
+import (
+	"sync"
+	"time"
+
+	"http-load-balancer/models"
+)
+
+type outlierState struct {
+	consecutiveErrors int
+	ejections         int
+	ejectedUntil      time.Time
+	routable          bool // enabled and alive as of the last Filter
+}
+
+// OutlierDetector ejects backends that keep failing live traffic without
+// waiting for the next active health check. Each repeated ejection lasts
+// longer (base * ejections, capped at max), and at most maxEjectionPercent
+// of the enabled, alive backends can be ejected at once.
+type OutlierDetector struct {
+	consecutiveErrors  int
+	baseEjectionTime   time.Duration
+	maxEjectionTime    time.Duration
+	maxEjectionPercent int
+
+	mu       sync.Mutex
+	hosts    map[uint64]*outlierState
+	poolSize int
+}
+
+func NewOutlierDetector(
+	consecutiveErrors int,
+	baseEjectionTime time.Duration,
+	maxEjectionTime time.Duration,
+	maxEjectionPercent int,
+) *OutlierDetector {
+	return &OutlierDetector{
+		consecutiveErrors:  consecutiveErrors,
+		baseEjectionTime:   baseEjectionTime,
+		maxEjectionTime:    maxEjectionTime,
+		maxEjectionPercent: maxEjectionPercent,
+		hosts:              make(map[uint64]*outlierState),
+	}
+}
+
+// Filter drops currently ejected backends from the pool and remembers how
+// many of it are enabled and alive for the max-ejection guard. Backends
+// that left the pool are forgotten.
+func (d *OutlierDetector) Filter(backends []models.Backend) []models.Backend {
+	now := time.Now()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.poolSize = 0
+	known := 0
+	filtered := make([]models.Backend, 0, len(backends))
+	for _, b := range backends {
+		if b.Ready() {
+			d.poolSize++
+		}
+		s, ok := d.hosts[b.ID]
+		if ok {
+			known++
+			s.routable = b.Ready()
+			if now.Before(s.ejectedUntil) {
+				continue
+			}
+		}
+		filtered = append(filtered, b)
+	}
+	if known < len(d.hosts) {
+		d.prune(backends)
+	}
+	return filtered
+}
+
+// prune forgets backends that are no longer in the pool.
+func (d *OutlierDetector) prune(backends []models.Backend) {
+	pool := make(map[uint64]struct{}, len(backends))
+	for _, b := range backends {
+		pool[b.ID] = struct{}{}
+	}
+	for id := range d.hosts {
+		if _, ok := pool[id]; !ok {
+			delete(d.hosts, id)
+		}
+	}
+}
+
+func (d *OutlierDetector) ReportSuccess(backendID uint64) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if s, ok := d.hosts[backendID]; ok {
+		s.consecutiveErrors = 0
+	}
+}
+
+// ReportFailure records a 5xx or connect error and returns the ejection
+// duration if this failure caused the backend to be ejected.
+func (d *OutlierDetector) ReportFailure(backendID uint64) (time.Duration, bool) {
+	if d.consecutiveErrors <= 0 {
+		return 0, false
+	}
+	now := time.Now()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	s, ok := d.hosts[backendID]
+	if !ok {
+		// failures are only reported for backends requests were routed to
+		s = &outlierState{routable: true}
+		d.hosts[backendID] = s
+	}
+	if now.Before(s.ejectedUntil) {
+		return 0, false
+	}
+
+	s.consecutiveErrors++
+	if s.consecutiveErrors < d.consecutiveErrors || !d.canEject(now) {
+		return 0, false
+	}
+
+	// a backend that stayed healthy for a full max period starts over
+	if !s.ejectedUntil.IsZero() && now.Sub(s.ejectedUntil) > d.maxEjectionTime {
+		s.ejections = 0
+	}
+	s.ejections++
+	s.consecutiveErrors = 0
+
+	duration := min(d.baseEjectionTime*time.Duration(s.ejections), d.maxEjectionTime)
+	s.ejectedUntil = now.Add(duration)
+	return duration, true
+}
+
+func (d *OutlierDetector) canEject(now time.Time) bool {
+	ejected := 0
+	for _, s := range d.hosts {
+		if s.routable && now.Before(s.ejectedUntil) {
+			ejected++
+		}
+	}
+	return (ejected+1)*100 <= d.poolSize*d.maxEjectionPercent
+}
@@ -0,0 +1,74 @@
+package healthcheck
+
+import (
+	"testing"
+	"time"
+
+	"http-load-balancer/models"
+)
+
+func outlierPool(enabled, draining int) []models.Backend {
+	var backends []models.Backend
+	for i := range enabled + draining {
+		state := models.BackendEnabled
+		if i >= enabled {
+			state = models.BackendDraining
+		}
+		backends = append(backends, models.Backend{ID: uint64(i + 1), IsAlive: true, State: state})
+	}
+	return backends
+}
+
+func TestOutlierMaxEjectionPercent(t *testing.T) {
+	tests := []struct {
+		name     string
+		enabled  int
+		draining int
+		percent  int
+		want     int
+	}{
+		{name: "half of four", enabled: 4, percent: 50, want: 2},
+		{name: "draining backends don't count", enabled: 4, draining: 4, percent: 50, want: 2},
+		{name: "one of one", enabled: 1, draining: 3, percent: 100, want: 1},
+		{name: "none below one backend", enabled: 1, draining: 3, percent: 50, want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := NewOutlierDetector(1, time.Minute, time.Hour, tt.percent)
+			backends := outlierPool(tt.enabled, tt.draining)
+			d.Filter(backends)
+
+			ejected := 0
+			for _, b := range backends[:tt.enabled] {
+				if _, ok := d.ReportFailure(b.ID); ok {
+					ejected++
+				}
+			}
+			if ejected != tt.want {
+				t.Fatalf("ejected %d, want %d", ejected, tt.want)
+			}
+			if left := len(d.Filter(backends)); left != len(backends)-tt.want {
+				t.Fatalf("%d backends left after filtering, want %d", left, len(backends)-tt.want)
+			}
+		})
+	}
+}
+
+func TestOutlierForgetsRemovedBackends(t *testing.T) {
+	d := NewOutlierDetector(1, time.Minute, time.Hour, 100)
+	backends := outlierPool(3, 0)
+	d.Filter(backends)
+	for _, b := range backends {
+		d.ReportFailure(b.ID)
+	}
+
+	d.Filter(backends[:1])
+	if len(d.hosts) != 1 {
+		t.Fatalf("%d hosts remembered, want 1", len(d.hosts))
+	}
+
+	// a backend that was removed comes back without its ejection
+	if got := d.Filter(backends); len(got) != 2 {
+		t.Fatalf("%d backends after re-adding, want 2", len(got))
+	}
+}
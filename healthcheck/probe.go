@@ -0,0 +1,168 @@
+package healthcheck
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"http-load-balancer/models"
+)
+
+// Probe types.
+const (
+	ProbeHTTP = "http"
+	ProbeTCP  = "tcp"
+	ProbeGRPC = "grpc"
+	ProbeExec = "exec"
+)
+
+// Prober checks whether a backend is healthy. It returns why it is not,
+// or nil if it is. ctx carries the probe timeout.
+type Prober interface {
+	Probe(ctx context.Context, backend models.Backend) error
+}
+
+// ProbeSettings describe how a backend is checked. Zero fields are filled
+// from the defaults: an HTTP GET /health expecting 200 within a second.
+type ProbeSettings struct {
+	// Type is http, tcp, grpc or exec.
+	Type    string
+	Timeout time.Duration
+
+	// http
+	Method string
+	Path   string
+	// Host overrides the Host header, for backends behind virtual hosting.
+	Host    string
+	Headers map[string]string
+	// Statuses are accepted codes or inclusive ranges: "200", "200-299".
+	Statuses []string
+	// BodyContains, BodyRegex and JSONPath all have to match when set.
+	BodyContains string
+	BodyRegex    string
+	// JSONPath is a dotted path into a JSON body, such as "status" or
+	// "checks.0.state". With JSONValue empty the path only has to exist.
+	JSONPath  string
+	JSONValue string
+
+	// grpc: the service to ask about; empty means the server as a whole.
+	Service string
+
+	// exec: the command and its arguments, run with BACKEND_ID and
+	// BACKEND_URL in its environment. Exit code 0 means healthy.
+	Command []string
+}
+
+// Merge returns s with the non-zero fields of override applied on top.
+// Headers are merged key by key.
+func (s ProbeSettings) Merge(override ProbeSettings) ProbeSettings {
+	if override.Type != "" {
+		s.Type = override.Type
+	}
+	if override.Timeout > 0 {
+		s.Timeout = override.Timeout
+	}
+	if override.Method != "" {
+		s.Method = override.Method
+	}
+	if override.Path != "" {
+		s.Path = override.Path
+	}
+	if override.Host != "" {
+		s.Host = override.Host
+	}
+	if len(override.Headers) > 0 {
+		headers := make(map[string]string, len(s.Headers)+len(override.Headers))
+		for k, v := range s.Headers {
+			headers[k] = v
+		}
+		for k, v := range override.Headers {
+			headers[k] = v
+		}
+		s.Headers = headers
+	}
+	if len(override.Statuses) > 0 {
+		s.Statuses = override.Statuses
+	}
+	if override.BodyContains != "" {
+		s.BodyContains = override.BodyContains
+	}
+	if override.BodyRegex != "" {
+		s.BodyRegex = override.BodyRegex
+	}
+	// the expected value only makes sense together with its path
+	if override.JSONPath != "" {
+		s.JSONPath = override.JSONPath
+		s.JSONValue = override.JSONValue
+	}
+	if override.Service != "" {
+		s.Service = override.Service
+	}
+	if len(override.Command) > 0 {
+		s.Command = override.Command
+	}
+	return s
+}
+
+// probe is a Prober together with its timeout.
+type probe struct {
+	prober  Prober
+	timeout time.Duration
+}
+
+// Probes picks the probe for a backend: its own override if it has one,
+// the default otherwise.
+type Probes struct {
+	def       probe
+	overrides map[string]probe // by backend URL
+}
+
+// NewProbes validates the default settings and the per-backend overrides,
+// which are applied on top of the default.
+func NewProbes(def ProbeSettings, overrides map[string]ProbeSettings) (*Probes, error) {
+	client := newHTTPClient()
+	p := &Probes{overrides: make(map[string]probe, len(overrides))}
+
+	var err error
+	if p.def, err = newProbe(def, client); err != nil {
+		return nil, err
+	}
+	for url, override := range overrides {
+		probe, err := newProbe(def.Merge(override), client)
+		if err != nil {
+			return nil, fmt.Errorf("backend %s: %w", url, err)
+		}
+		p.overrides[url] = probe
+	}
+	return p, nil
+}
+
+func (p *Probes) lookup(url string) probe {
+	if probe, ok := p.overrides[url]; ok {
+		return probe
+	}
+	return p.def
+}
+
+func newProbe(settings ProbeSettings, client *http.Client) (probe, error) {
+	p := probe{timeout: settings.Timeout}
+	if p.timeout <= 0 {
+		p.timeout = time.Second
+	}
+
+	var err error
+	switch settings.Type {
+	case ProbeHTTP, "":
+		p.prober, err = newHTTPProber(settings, client)
+	case ProbeTCP:
+		p.prober = tcpProber{}
+	case ProbeGRPC:
+		p.prober = newGRPCProber(settings.Service)
+	case ProbeExec:
+		p.prober, err = newExecProber(settings.Command)
+	default:
+		err = fmt.Errorf("unknown health check type %q", settings.Type)
+	}
+	return p, err
+}
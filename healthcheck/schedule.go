@@ -0,0 +1,89 @@
+package healthcheck
+
+import (
+	"math/rand/v2"
+	"time"
+
+	"http-load-balancer/models"
+)
+
+type Schedule struct {
+	// Interval between checks of a healthy backend.
+	Interval time.Duration
+	// UnhealthyInterval between checks of a backend that is down or has
+	// started failing. Zero means Interval.
+	UnhealthyInterval time.Duration
+	// MaxBackoff caps the unhealthy interval, which doubles with every
+	// failed check of a backend that is already down. Zero disables backoff.
+	MaxBackoff time.Duration
+	// Jitter is the fraction of an interval by which each check is moved
+	// at random, so backends aren't all probed at the same moment.
+	Jitter float64
+	// Rise and Fall are how many checks in a row have to pass or fail
+	// before a backend is marked up or down.
+	Rise int
+	Fall int
+}
+
+func (s Schedule) withDefaults() Schedule {
+	if s.UnhealthyInterval <= 0 {
+		s.UnhealthyInterval = s.Interval
+	}
+	s.Jitter = min(max(s.Jitter, 0), 1)
+	s.Rise = max(s.Rise, 1)
+	s.Fall = max(s.Fall, 1)
+	return s
+}
+
+// probeState is what the checker remembers about one backend between
+// checks.
+type probeState struct {
+	successes int // in a row
+	failures  int // in a row
+	next      time.Time
+	inFlight  bool
+	last      models.HealthEvent // latest check, not stored
+}
+
+// record counts a check result and reports whether the backend has to be
+// marked up or down because of it.
+func (s Schedule) record(st *probeState, isAlive, passed bool) (change bool) {
+	if passed {
+		st.successes++
+		st.failures = 0
+		return !isAlive && st.successes >= s.Rise
+	}
+	st.failures++
+	st.successes = 0
+	return isAlive && st.failures >= s.Fall
+}
+
+// delay is how long to wait before the next check of a backend.
+func (s Schedule) delay(st *probeState, isAlive bool) time.Duration {
+	d := s.Interval
+	switch {
+	case !isAlive && s.MaxBackoff > 0:
+		// the first checks after going down run at the unhealthy
+		// interval, then it doubles with every further failure
+		d = s.UnhealthyInterval
+		for i := s.Fall; i < st.failures && d < s.MaxBackoff; i++ {
+			d *= 2
+		}
+		d = min(d, max(s.MaxBackoff, s.UnhealthyInterval))
+	case !isAlive || st.failures > 0:
+		d = s.UnhealthyInterval
+	}
+	return s.jitter(d)
+}
+
+// firstDelay spreads the first checks of backends over one jitter window.
+func (s Schedule) firstDelay() time.Duration {
+	return time.Duration(rand.Float64() * s.Jitter * float64(s.Interval))
+}
+
+func (s Schedule) jitter(d time.Duration) time.Duration {
+	if s.Jitter == 0 {
+		return d
+	}
+	return time.Duration(float64(d) * (1 + s.Jitter*(2*rand.Float64()-1)))
+}
@@ -0,0 +1,115 @@
+package healthcheck
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScheduleRecord(t *testing.T) {
+	s := Schedule{Rise: 2, Fall: 3}.withDefaults()
+	tests := []struct {
+		name    string
+		isAlive bool
+		results []bool
+		// changes is the index of the check that flips the backend, -1 if
+		// none does
+		changes int
+	}{
+		{name: "healthy stays up", isAlive: true, results: []bool{true, true, true}, changes: -1},
+		{name: "down after fall failures", isAlive: true, results: []bool{false, false, false}, changes: 2},
+		{name: "a pass resets failures", isAlive: true, results: []bool{false, false, true, false, false}, changes: -1},
+		{name: "up after rise passes", isAlive: false, results: []bool{false, true, true}, changes: 2},
+		{name: "a failure resets passes", isAlive: false, results: []bool{true, false, true}, changes: -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st := &probeState{}
+			isAlive := tt.isAlive
+			changes := -1
+			for i, passed := range tt.results {
+				if s.record(st, isAlive, passed) {
+					if changes >= 0 {
+						t.Fatalf("changed twice, at %d and %d", changes, i)
+					}
+					changes = i
+					isAlive = passed
+				}
+			}
+			if changes != tt.changes {
+				t.Fatalf("changed at check %d, want %d", changes, tt.changes)
+			}
+		})
+	}
+}
+
+func TestScheduleDelay(t *testing.T) {
+	s := Schedule{
+		Interval:          10 * time.Second,
+		UnhealthyInterval: 2 * time.Second,
+		MaxBackoff:        30 * time.Second,
+		Fall:              3,
+	}.withDefaults()
+
+	tests := []struct {
+		name     string
+		schedule Schedule
+		isAlive  bool
+		failures int
+		want     time.Duration
+	}{
+		{name: "healthy", schedule: s, isAlive: true, want: 10 * time.Second},
+		{name: "failing", schedule: s, isAlive: true, failures: 1, want: 2 * time.Second},
+		{name: "just down", schedule: s, isAlive: false, failures: 3, want: 2 * time.Second},
+		{name: "recovering", schedule: s, isAlive: false, failures: 0, want: 2 * time.Second},
+		{name: "backoff", schedule: s, isAlive: false, failures: 4, want: 4 * time.Second},
+		{name: "more backoff", schedule: s, isAlive: false, failures: 6, want: 16 * time.Second},
+		{name: "capped", schedule: s, isAlive: false, failures: 7, want: 30 * time.Second},
+		{name: "stays capped", schedule: s, isAlive: false, failures: 100, want: 30 * time.Second},
+		{
+			name:     "no backoff",
+			schedule: Schedule{Interval: 10 * time.Second, UnhealthyInterval: 2 * time.Second, Fall: 3}.withDefaults(),
+			failures: 10,
+			want:     2 * time.Second,
+		},
+		{
+			name: "cap below the unhealthy interval",
+			schedule: Schedule{
+				Interval: 10 * time.Second, UnhealthyInterval: 2 * time.Second, MaxBackoff: time.Second, Fall: 3,
+			}.withDefaults(),
+			failures: 10,
+			want:     2 * time.Second,
+		},
+		{
+			name:     "unhealthy interval defaults to interval",
+			schedule: Schedule{Interval: 10 * time.Second}.withDefaults(),
+			isAlive:  true,
+			failures: 1,
+			want:     10 * time.Second,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.schedule.delay(&probeState{failures: tt.failures}, tt.isAlive)
+			if got != tt.want {
+				t.Fatalf("delay = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScheduleJitter(t *testing.T) {
+	s := Schedule{Interval: 10 * time.Second, Jitter: 0.2}.withDefaults()
+	lo, hi := 8*time.Second, 12*time.Second
+	for range 1000 {
+		if d := s.delay(&probeState{}, true); d < lo || d > hi {
+			t.Fatalf("delay %v outside [%v, %v]", d, lo, hi)
+		}
+		if d := s.firstDelay(); d < 0 || d > 2*time.Second {
+			t.Fatalf("first delay %v outside [0, 2s]", d)
+		}
+	}
+
+	if j := (Schedule{Jitter: 5}).withDefaults().Jitter; j != 1 {
+		t.Fatalf("jitter = %v, want it capped at 1", j)
+	}
+}
@@ -0,0 +1,20 @@
+package healthcheck
+
+import (
+	"context"
+	"net"
+
+	"http-load-balancer/models"
+)
+
+// tcpProber considers a backend healthy if it accepts a TCP connection.
+type tcpProber struct{}
+
+func (tcpProber) Probe(ctx context.Context, backend models.Backend) error {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", backend.URL)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
@@ -0,0 +1,101 @@
+package identity
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"http-load-balancer/repository"
+)
+
+const (
+	// apiKeyTTL bounds how long a key is trusted without asking the DB,
+	// for keys changed behind the API's back.
+	apiKeyTTL = time.Minute
+	// apiKeyMissTTL is how long an unknown key is cached, so requests with
+	// made-up keys don't each cost a DB query.
+	apiKeyMissTTL = 5 * time.Second
+	// maxAPIKeys caps the cache; it is emptied when full.
+	maxAPIKeys = 100_000
+)
+
+// cachedKey is a looked up key; a clientID of 0 is an unknown key.
+type cachedKey struct {
+	clientID uint64
+	expires  time.Time
+}
+
+// APIKey identifies clients by the api_key stored with them in the DB.
+// Keys are cached in memory, unknown ones included; Forget drops a
+// client's key once it has been rotated or the client deleted.
+type APIKey struct {
+	header string
+	repo   repository.UserRepository
+
+	mu   sync.RWMutex
+	keys map[string]cachedKey
+}
+
+func NewAPIKey(header string, repo repository.UserRepository) *APIKey {
+	return &APIKey{
+		header: header,
+		repo:   repo,
+		keys:   make(map[string]cachedKey),
+	}
+}
+
+func (a *APIKey) Identify(req *http.Request) (uint64, error) {
+	const op = "identity.APIKey.Identify"
+
+	key := req.Header.Get(a.header)
+	if key == "" {
+		return 0, ErrNotIdentified
+	}
+
+	now := time.Now()
+	a.mu.RLock()
+	cached, ok := a.keys[key]
+	a.mu.RUnlock()
+	if ok && now.Before(cached.expires) {
+		if cached.clientID == 0 {
+			return 0, fmt.Errorf("%s: %w", op, ErrInvalidCredentials)
+		}
+		return cached.clientID, nil
+	}
+
+	user, err := a.repo.GetByAPIKey(key)
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			a.remember(key, cachedKey{expires: now.Add(apiKeyMissTTL)})
+			return 0, fmt.Errorf("%s: %w", op, ErrInvalidCredentials)
+		}
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	a.remember(key, cachedKey{clientID: user.ID, expires: now.Add(apiKeyTTL)})
+	return user.ID, nil
+}
+
+func (a *APIKey) remember(key string, cached cachedKey) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if len(a.keys) >= maxAPIKeys {
+		clear(a.keys)
+	}
+	a.keys[key] = cached
+}
+
+// Forget drops the cached key of a client, e.g. after it was rotated or
+// the client was deleted, so the old key stops working right away.
+func (a *APIKey) Forget(clientID uint64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for key, cached := range a.keys {
+		if cached.clientID == clientID {
+			delete(a.keys, key)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package identity
+
+import (
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+
+	"http-load-balancer/models"
+	"http-load-balancer/repository"
+)
+
+type fakeKeys struct {
+	repository.UserRepository
+	keys    map[string]uint64
+	lookups int
+}
+
+func (f *fakeKeys) GetByAPIKey(key string) (models.User, error) {
+	f.lookups++
+	id, ok := f.keys[key]
+	if !ok {
+		return models.User{}, fmt.Errorf("fakeKeys.GetByAPIKey: %w", repository.ErrUserNotFound)
+	}
+	return models.User{ID: id}, nil
+}
+
+func TestAPIKeyCache(t *testing.T) {
+	repo := &fakeKeys{keys: map[string]uint64{"old": 1}}
+	a := NewAPIKey("X-API-Key", repo)
+
+	identify := func(key string) (uint64, error) {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("X-API-Key", key)
+		return a.Identify(req)
+	}
+
+	for range 3 {
+		if id, err := identify("old"); err != nil || id != 1 {
+			t.Fatalf("Identify() = %d, %v, want 1", id, err)
+		}
+		if _, err := identify("made-up"); !errors.Is(err, ErrInvalidCredentials) {
+			t.Fatalf("err = %v, want ErrInvalidCredentials", err)
+		}
+	}
+	if repo.lookups != 2 {
+		t.Fatalf("%d lookups, want 2", repo.lookups)
+	}
+
+	// rotation
+	delete(repo.keys, "old")
+	repo.keys["new"] = 1
+	a.Forget(1)
+	if _, err := identify("old"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("old key after rotation: err = %v, want ErrInvalidCredentials", err)
+	}
+	if id, err := identify("new"); err != nil || id != 1 {
+		t.Fatalf("Identify() = %d, %v, want 1", id, err)
+	}
+}
@@ -0,0 +1,64 @@
+package identity
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+)
+
+// BodyField reads the client ID from a top-level field of a JSON body. The
+// body is read through req.GetBody, so what gets proxied is left intact.
+// Requests whose Content-Type is not application/json are left to the next
+// identifier.
+type BodyField struct {
+	field string
+}
+
+func NewBodyField(field string) *BodyField {
+	return &BodyField{field: field}
+}
+
+func (b *BodyField) Identify(req *http.Request) (uint64, error) {
+	const op = "identity.BodyField.Identify"
+
+	if req.ContentLength == 0 || req.GetBody == nil {
+		return 0, ErrNotIdentified
+	}
+	mediaType, _, err := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	if err != nil || mediaType != "application/json" {
+		return 0, ErrNotIdentified
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	defer body.Close()
+
+	var fields map[string]json.RawMessage
+	if err := json.NewDecoder(body).Decode(&fields); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, ErrInvalidBody)
+	}
+	raw, ok := fields[b.field]
+	if !ok {
+		return 0, ErrNotIdentified
+	}
+
+	clientID, err := parseID(raw)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, ErrInvalidCredentials)
+	}
+	return clientID, nil
+}
+
+// parseID accepts both 42 and "42".
+func parseID(raw json.RawMessage) (uint64, error) {
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return strconv.ParseUint(s, 10, 64)
+	}
+	var n uint64
+	err := json.Unmarshal(raw, &n)
+	return n, err
+}
@@ -0,0 +1,67 @@
+package identity
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestBodyFieldIdentify(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		want        uint64
+		wantErr     error
+	}{
+		{name: "number", contentType: "application/json", body: `{"client_id": 42}`, want: 42},
+		{name: "string", contentType: "application/json; charset=utf-8", body: `{"client_id": "42"}`, want: 42},
+		{name: "no field", contentType: "application/json", body: `{"other": 1}`, wantErr: ErrNotIdentified},
+		{name: "bad id", contentType: "application/json", body: `{"client_id": "abc"}`, wantErr: ErrInvalidCredentials},
+		{name: "broken json", contentType: "application/json", body: `{"client_id":`, wantErr: ErrInvalidBody},
+		{name: "form", contentType: "application/x-www-form-urlencoded", body: "client_id=42", wantErr: ErrNotIdentified},
+		{name: "no content type", body: `{"client_id": 42}`, wantErr: ErrNotIdentified},
+		{name: "no body", contentType: "application/json", wantErr: ErrNotIdentified},
+	}
+	b := NewBodyField("client_id")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// unlike httptest, http.NewRequest sets GetBody
+			req, err := http.NewRequest("POST", "/", strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+
+			got, err := b.Identify(req)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Fatalf("Identify() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestChainFallsThroughNonJSONBody(t *testing.T) {
+	req, err := http.NewRequest("POST", "/", strings.NewReader("<xml/>"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "text/xml")
+	req.Header.Set("X-Client-ID", "7")
+
+	chain := NewChain(true, NewBodyField("client_id"), NewHeader("X-Client-ID"))
+	if id, err := chain.Identify(req); err != nil || id != 7 {
+		t.Fatalf("Identify() = %d, %v, want 7", id, err)
+	}
+
+	req.Header.Del("X-Client-ID")
+	if _, err := chain.Identify(req); !errors.Is(err, ErrNotIdentified) {
+		t.Fatalf("err = %v, want ErrNotIdentified", err)
+	}
+}
@@ -0,0 +1,58 @@
+package identity
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+)
+
+type cidrRule struct {
+	prefix   netip.Prefix
+	clientID uint64
+}
+
+// CIDR maps the remote address onto a client by the most specific matching
+// network. X-Forwarded-For is deliberately ignored as it's client-supplied.
+type CIDR struct {
+	rules []cidrRule
+}
+
+func NewCIDR(networks map[string]uint64) (*CIDR, error) {
+	const op = "identity.NewCIDR"
+
+	rules := make([]cidrRule, 0, len(networks))
+	for network, clientID := range networks {
+		prefix, err := netip.ParsePrefix(network)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		rules = append(rules, cidrRule{prefix: prefix.Masked(), clientID: clientID})
+	}
+	return &CIDR{rules: rules}, nil
+}
+
+func (c *CIDR) Identify(req *http.Request) (uint64, error) {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		host = req.RemoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return 0, ErrNotIdentified
+	}
+	addr = addr.Unmap()
+
+	best := -1
+	var clientID uint64
+	for _, rule := range c.rules {
+		if rule.prefix.Contains(addr) && rule.prefix.Bits() > best {
+			best = rule.prefix.Bits()
+			clientID = rule.clientID
+		}
+	}
+	if best < 0 {
+		return 0, ErrNotIdentified
+	}
+	return clientID, nil
+}
@@ -0,0 +1,9 @@
+package identity
+
+import "errors"
+
+var (
+	ErrNotIdentified      = errors.New("client not identified")
+	ErrInvalidCredentials = errors.New("invalid client credentials")
+	ErrInvalidBody        = errors.New("request body must be a JSON object")
+)
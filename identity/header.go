@@ -0,0 +1,31 @@
+package identity
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+// Header takes the client ID verbatim from a request header. It is meant
+// for traffic coming from trusted gateways that already authenticated it.
+type Header struct {
+	name string
+}
+
+func NewHeader(name string) *Header {
+	return &Header{name: name}
+}
+
+func (h *Header) Identify(req *http.Request) (uint64, error) {
+	const op = "identity.Header.Identify"
+
+	raw := req.Header.Get(h.name)
+	if raw == "" {
+		return 0, ErrNotIdentified
+	}
+	clientID, err := strconv.ParseUint(raw, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, ErrInvalidCredentials)
+	}
+	return clientID, nil
+}
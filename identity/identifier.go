@@ -0,0 +1,41 @@
+package identity
+
+import (
+	"errors"
+	"net/http"
+)
+
+// ClientIdentifier resolves the client a request belongs to. It returns
+// ErrNotIdentified when the request carries nothing it understands, so the
+// next identifier in a Chain can have a go; any other error is final.
+type ClientIdentifier interface {
+	Identify(req *http.Request) (uint64, error)
+}
+
+// Chain tries identifiers in order and returns the first match. When none
+// matches it returns 0 (anonymous), or ErrNotIdentified if required is set.
+type Chain struct {
+	identifiers []ClientIdentifier
+	required    bool
+}
+
+func NewChain(required bool, identifiers ...ClientIdentifier) *Chain {
+	return &Chain{
+		identifiers: identifiers,
+		required:    required,
+	}
+}
+
+func (c *Chain) Identify(req *http.Request) (uint64, error) {
+	for _, identifier := range c.identifiers {
+		clientID, err := identifier.Identify(req)
+		if errors.Is(err, ErrNotIdentified) {
+			continue
+		}
+		return clientID, err
+	}
+	if c.required {
+		return 0, ErrNotIdentified
+	}
+	return 0, nil
+}
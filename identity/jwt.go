@@ -0,0 +1,170 @@
+package identity
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// JWT identifies clients by a claim of a bearer token signed with HS256 or
+// RS256. Only keys configured locally are trusted; the token's own header
+// never selects a key, and "none" is always rejected.
+type JWT struct {
+	header    string
+	claim     string
+	hmacKey   []byte
+	rsaKey    *rsa.PublicKey
+	clockSkew time.Duration
+}
+
+func NewJWT(header, claim string, hmacKey []byte, rsaKey *rsa.PublicKey) (*JWT, error) {
+	if len(hmacKey) == 0 && rsaKey == nil {
+		return nil, errors.New("identity.NewJWT: either an HS256 secret or an RS256 public key is required")
+	}
+	return &JWT{
+		header:    header,
+		claim:     claim,
+		hmacKey:   hmacKey,
+		rsaKey:    rsaKey,
+		clockSkew: 30 * time.Second,
+	}, nil
+}
+
+func LoadRSAPublicKey(path string) (*rsa.PublicKey, error) {
+	const op = "identity.LoadRSAPublicKey"
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM data in %s", op, path)
+	}
+
+	if key, err := x509.ParsePKCS1PublicKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	key, ok := parsed.(*rsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("%s: %s is not an RSA public key", op, path)
+	}
+	return key, nil
+}
+
+func (j *JWT) Identify(req *http.Request) (uint64, error) {
+	const op = "identity.JWT.Identify"
+
+	token, ok := strings.CutPrefix(req.Header.Get(j.header), "Bearer ")
+	if !ok || token == "" {
+		return 0, ErrNotIdentified
+	}
+
+	claims, err := j.verify(token)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w: %w", op, ErrInvalidCredentials, err)
+	}
+
+	raw, ok := claims[j.claim]
+	if !ok {
+		return 0, fmt.Errorf("%s: %w: claim %q missing", op, ErrInvalidCredentials, j.claim)
+	}
+	clientID, err := parseID(raw)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w: claim %q is not a client ID", op, ErrInvalidCredentials, j.claim)
+	}
+	return clientID, nil
+}
+
+func (j *JWT) verify(token string) (map[string]json.RawMessage, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed token")
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, err
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, err
+	}
+	signed := []byte(parts[0] + "." + parts[1])
+
+	switch {
+	case header.Alg == "HS256" && len(j.hmacKey) > 0:
+		mac := hmac.New(sha256.New, j.hmacKey)
+		mac.Write(signed)
+		if !hmac.Equal(sig, mac.Sum(nil)) {
+			return nil, errors.New("bad signature")
+		}
+	case header.Alg == "RS256" && j.rsaKey != nil:
+		digest := sha256.Sum256(signed)
+		if err := rsa.VerifyPKCS1v15(j.rsaKey, crypto.SHA256, digest[:], sig); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported alg %q", header.Alg)
+	}
+
+	var claims map[string]json.RawMessage
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, err
+	}
+	if err := j.checkTime(claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+func (j *JWT) checkTime(claims map[string]json.RawMessage) error {
+	now := time.Now()
+	if raw, ok := claims["exp"]; ok {
+		var exp float64
+		if err := json.Unmarshal(raw, &exp); err != nil {
+			return errors.New("invalid exp")
+		}
+		if now.After(time.Unix(int64(exp), 0).Add(j.clockSkew)) {
+			return errors.New("token expired")
+		}
+	}
+	if raw, ok := claims["nbf"]; ok {
+		var nbf float64
+		if err := json.Unmarshal(raw, &nbf); err != nil {
+			return errors.New("invalid nbf")
+		}
+		if now.Add(j.clockSkew).Before(time.Unix(int64(nbf), 0)) {
+			return errors.New("token not valid yet")
+		}
+	}
+	return nil
+}
+
+func decodeSegment(segment string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	return dec.Decode(v)
+}
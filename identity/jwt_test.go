@@ -0,0 +1,112 @@
+package identity
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testSecret = []byte("secret")
+
+func segment(s string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(s))
+}
+
+func signHS256(key []byte, header, claims string) string {
+	signed := segment(header) + "." + segment(claims)
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(signed))
+	return signed + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func signRS256(t *testing.T, key *rsa.PrivateKey, claims string) string {
+	t.Helper()
+	signed := segment(`{"alg":"RS256","typ":"JWT"}`) + "." + segment(claims)
+	digest := sha256.Sum256([]byte(signed))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func TestJWTIdentify(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hs256 := `{"alg":"HS256","typ":"JWT"}`
+	now := time.Now().Unix()
+	at := func(offset time.Duration) int64 { return now + int64(offset/time.Second) }
+
+	hmacOnly, _ := NewJWT("Authorization", "sub", testSecret, nil)
+	rsaOnly, _ := NewJWT("Authorization", "sub", nil, &rsaKey.PublicKey)
+	rsaPub := x509.MarshalPKCS1PublicKey(&rsaKey.PublicKey)
+	parts := strings.Split(signHS256(testSecret, hs256, `{"sub":"42"}`), ".")
+	tampered := parts[0] + "." + segment(`{"sub":"1"}`) + "." + parts[2]
+
+	tests := []struct {
+		name   string
+		jwt    *JWT
+		header string
+		want   uint64
+		err    error
+	}{
+		{"hs256", hmacOnly, "Bearer " + signHS256(testSecret, hs256, `{"sub":"42"}`), 42, nil},
+		{"numeric claim", hmacOnly, "Bearer " + signHS256(testSecret, hs256, `{"sub":42}`), 42, nil},
+		{"rs256", rsaOnly, "Bearer " + signRS256(t, rsaKey, `{"sub":"7"}`), 7, nil},
+		{"no token", hmacOnly, "", 0, ErrNotIdentified},
+		{"not bearer", hmacOnly, "Basic dXNlcjpwYXNz", 0, ErrNotIdentified},
+		{"malformed", hmacOnly, "Bearer abc.def", 0, ErrInvalidCredentials},
+		{"wrong secret", hmacOnly, "Bearer " + signHS256([]byte("other"), hs256, `{"sub":"42"}`), 0, ErrInvalidCredentials},
+		{"tampered claims", hmacOnly, "Bearer " + tampered, 0, ErrInvalidCredentials},
+		{"alg none", hmacOnly, "Bearer " + segment(`{"alg":"none"}`) + "." + segment(`{"sub":"42"}`) + ".", 0, ErrInvalidCredentials},
+		// a token signed with the public key as an HMAC secret
+		{"alg confusion", rsaOnly, "Bearer " + signHS256(rsaPub, hs256, `{"sub":"42"}`), 0, ErrInvalidCredentials},
+		{"rs256 without key", hmacOnly, "Bearer " + signRS256(t, rsaKey, `{"sub":"7"}`), 0, ErrInvalidCredentials},
+		{"expired", hmacOnly, "Bearer " + signHS256(testSecret, hs256,
+			`{"sub":"42","exp":`+itoa(at(-time.Minute))+`}`), 0, ErrInvalidCredentials},
+		{"expired within skew", hmacOnly, "Bearer " + signHS256(testSecret, hs256,
+			`{"sub":"42","exp":`+itoa(at(-10*time.Second))+`}`), 42, nil},
+		{"not valid yet", hmacOnly, "Bearer " + signHS256(testSecret, hs256,
+			`{"sub":"42","nbf":`+itoa(at(time.Minute))+`}`), 0, ErrInvalidCredentials},
+		{"invalid exp", hmacOnly, "Bearer " + signHS256(testSecret, hs256, `{"sub":"42","exp":"soon"}`), 0, ErrInvalidCredentials},
+		{"missing claim", hmacOnly, "Bearer " + signHS256(testSecret, hs256, `{"user":"42"}`), 0, ErrInvalidCredentials},
+		{"claim not an ID", hmacOnly, "Bearer " + signHS256(testSecret, hs256, `{"sub":"alice"}`), 0, ErrInvalidCredentials},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			got, err := tt.jwt.Identify(req)
+			if !errors.Is(err, tt.err) || (tt.err == nil && err != nil) {
+				t.Fatalf("err = %v, want %v", err, tt.err)
+			}
+			if got != tt.want {
+				t.Fatalf("client ID = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewJWTNeedsKey(t *testing.T) {
+	if _, err := NewJWT("Authorization", "sub", nil, nil); err == nil {
+		t.Fatal("NewJWT accepted no keys")
+	}
+}
+
+func itoa(n int64) string {
+	return strconv.FormatInt(n, 10)
+}
@@ -3,20 +3,66 @@ CREATE TABLE IF NOT EXISTS backend (
     id SERIAL PRIMARY KEY,
     url VARCHAR(255) NOT NULL UNIQUE,
     is_alive BOOLEAN DEFAULT TRUE,
+    state VARCHAR(16) NOT NULL DEFAULT 'enabled' CHECK (state IN ('enabled', 'draining', 'disabled')),
+    weight INTEGER NOT NULL DEFAULT 1 CHECK (weight > 0),
+    max_rps INTEGER NOT NULL DEFAULT 0 CHECK (max_rps >= 0),
     active_conns INTEGER DEFAULT 0,
     created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
 );
 
--- Таблица для rate-limiting
+-- Тарифные планы: лимиты, общие для многих клиентов
+CREATE TABLE IF NOT EXISTS plan (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(64) NOT NULL UNIQUE,
+    capacity INTEGER NOT NULL CHECK (capacity > 0),
+    rate_per_sec INTEGER NOT NULL CHECK (rate_per_sec > 0),
+    window_sec INTEGER NOT NULL DEFAULT 1 CHECK (window_sec > 0),
+    quota_limit BIGINT NOT NULL DEFAULT 0 CHECK (quota_limit >= 0),
+    quota_period VARCHAR(8) NOT NULL DEFAULT 'month',
+    max_concurrent INTEGER NOT NULL DEFAULT 0 CHECK (max_concurrent >= 0),
+    priority INTEGER NOT NULL DEFAULT 0
+);
+
+-- Таблица для rate-limiting. Лимиты со значением NULL берутся из плана клиента
+-- (или из плана default, если план не задан)
 CREATE TABLE IF NOT EXISTS client (
     id SERIAL PRIMARY KEY,
-    capacity INTEGER NOT NULL,
-    rate_per_sec INTEGER NOT NULL,
+    api_key VARCHAR(64) NOT NULL UNIQUE DEFAULT md5(random()::text || clock_timestamp()::text),
+    plan_id INTEGER REFERENCES plan(id) ON DELETE RESTRICT,
+    capacity INTEGER CHECK (capacity > 0),
+    rate_per_sec INTEGER CHECK (rate_per_sec > 0),
+    window_sec INTEGER CHECK (window_sec > 0),
     tokens INTEGER NOT NULL,
+    algorithm VARCHAR(32) NOT NULL DEFAULT 'token_bucket',
+    shadow BOOLEAN NOT NULL DEFAULT FALSE,
+    quota_limit BIGINT CHECK (quota_limit >= 0),
+    quota_period VARCHAR(8),
+    max_concurrent INTEGER CHECK (max_concurrent >= 0),
     last_updated TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
 );
 
+-- Использование квот клиентами по календарным окнам
+CREATE TABLE IF NOT EXISTS client_usage (
+    client_id INTEGER NOT NULL REFERENCES client(id) ON DELETE CASCADE,
+    period VARCHAR(8) NOT NULL,
+    window_start TIMESTAMP WITH TIME ZONE NOT NULL,
+    requests BIGINT NOT NULL DEFAULT 0,
+    PRIMARY KEY (client_id, period, window_start)
+);
+
+-- История переходов бэкендов между живым и лежащим состоянием по health check
+CREATE TABLE IF NOT EXISTS backend_health_event (
+    id SERIAL PRIMARY KEY,
+    backend_id INTEGER NOT NULL REFERENCES backend(id) ON DELETE CASCADE,
+    is_alive BOOLEAN NOT NULL,
+    reason VARCHAR(64) NOT NULL,
+    error TEXT NOT NULL DEFAULT '',
+    latency_ms INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
 -- Индексы
 CREATE INDEX IF NOT EXISTS idx_backends_active ON backend(is_alive);
-CREATE UNIQUE INDEX IF NOT EXISTS idx_backends_url ON backend(url);
\ No newline at end of file
+CREATE UNIQUE INDEX IF NOT EXISTS idx_backends_url ON backend(url);
+CREATE INDEX IF NOT EXISTS idx_backend_health_event_backend ON backend_health_event(backend_id, created_at);
\ No newline at end of file
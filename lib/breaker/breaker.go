@@ -0,0 +1,179 @@
+package breaker
+
+import (
+	"sync"
+	"time"
+)
+
+type State int
+
+const (
+	StateClosed State = iota
+	StateOpen
+	StateHalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+type Settings struct {
+	// FailureRatio of failed requests within Interval that trips the
+	// breaker. Zero or less disables the breaker.
+	FailureRatio float64
+	// MinRequests within Interval before FailureRatio is evaluated.
+	MinRequests int
+	// Interval after which closed-state counters are reset.
+	Interval time.Duration
+	// OpenDuration before an open breaker lets probes through.
+	OpenDuration time.Duration
+	// HalfOpenProbes is both the number of concurrent probes allowed in
+	// half-open state and the number of successes needed to close again.
+	HalfOpenProbes int
+}
+
+// Breaker is a closed/open/half-open circuit breaker for one backend.
+type Breaker struct {
+	settings Settings
+
+	mu             sync.Mutex
+	state          State
+	requests       int
+	failures       int
+	windowStart    time.Time
+	openedAt       time.Time
+	probesInFlight int
+	probeSuccesses int
+}
+
+func New(settings Settings) *Breaker {
+	settings.HalfOpenProbes = max(settings.HalfOpenProbes, 1)
+	return &Breaker{
+		settings:    settings,
+		windowStart: time.Now(),
+	}
+}
+
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.currentState(time.Now())
+}
+
+// Ready reports whether a request could be let through right now without
+// reserving a slot; the balancer uses it to mark backends for strategies.
+func (b *Breaker) Ready() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.currentState(time.Now()) {
+	case StateOpen:
+		return false
+	case StateHalfOpen:
+		return b.probesInFlight < b.settings.HalfOpenProbes
+	default:
+		return true
+	}
+}
+
+// Allow reserves a slot for a request. Every successful Allow must be
+// followed by exactly one Done.
+func (b *Breaker) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.currentState(time.Now()) {
+	case StateOpen:
+		return false
+	case StateHalfOpen:
+		if b.probesInFlight >= b.settings.HalfOpenProbes {
+			return false
+		}
+		b.probesInFlight++
+	default:
+	}
+	return true
+}
+
+func (b *Breaker) Done(success bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	switch b.currentState(now) {
+	case StateHalfOpen:
+		b.probesInFlight = max(b.probesInFlight-1, 0)
+		if !success {
+			b.open(now)
+			return
+		}
+		b.probeSuccesses++
+		if b.probeSuccesses >= b.settings.HalfOpenProbes {
+			b.close(now)
+		}
+	case StateClosed:
+		b.requests++
+		if !success {
+			b.failures++
+		}
+		if b.settings.FailureRatio > 0 &&
+			b.requests >= b.settings.MinRequests &&
+			float64(b.failures)/float64(b.requests) >= b.settings.FailureRatio {
+			b.open(now)
+		}
+	default:
+		// request was admitted before the breaker opened
+	}
+}
+
+// Cancel releases a slot reserved by Allow without recording an outcome,
+// e.g. when the client went away before the backend answered.
+func (b *Breaker) Cancel() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.currentState(time.Now()) == StateHalfOpen {
+		b.probesInFlight = max(b.probesInFlight-1, 0)
+	}
+}
+
+func (b *Breaker) currentState(now time.Time) State {
+	switch b.state {
+	case StateOpen:
+		if now.Sub(b.openedAt) >= b.settings.OpenDuration {
+			b.state = StateHalfOpen
+			b.probesInFlight = 0
+			b.probeSuccesses = 0
+		}
+	case StateClosed:
+		if b.settings.Interval > 0 && now.Sub(b.windowStart) >= b.settings.Interval {
+			b.requests = 0
+			b.failures = 0
+			b.windowStart = now
+		}
+	default:
+	}
+	return b.state
+}
+
+func (b *Breaker) open(now time.Time) {
+	b.state = StateOpen
+	b.openedAt = now
+}
+
+func (b *Breaker) close(now time.Time) {
+	b.state = StateClosed
+	b.requests = 0
+	b.failures = 0
+	b.windowStart = now
+}
@@ -0,0 +1,162 @@
+package breaker
+
+import (
+	"testing"
+	"time"
+)
+
+var testSettings = Settings{
+	FailureRatio:   0.5,
+	MinRequests:    4,
+	Interval:       time.Minute,
+	OpenDuration:   10 * time.Second,
+	HalfOpenProbes: 2,
+}
+
+// apply runs one step against b:
+//
+//	ok, fail  a request that was let through and succeeded or failed
+//	cancel    a request that was let through and cancelled
+//	deny      a request that must not be let through
+//	hold      a request let through and left in flight
+//	wait      OpenDuration passes
+//	interval  Interval passes
+func apply(t *testing.T, b *Breaker, op string) {
+	t.Helper()
+	switch op {
+	case "ok", "fail", "cancel", "hold":
+		if !b.Allow() {
+			t.Fatalf("%s: request denied in state %v", op, b.State())
+		}
+		switch op {
+		case "ok":
+			b.Done(true)
+		case "fail":
+			b.Done(false)
+		case "cancel":
+			b.Cancel()
+		}
+	case "deny":
+		if b.Allow() {
+			t.Fatalf("request let through in state %v", b.State())
+		}
+	case "wait":
+		b.mu.Lock()
+		b.openedAt = b.openedAt.Add(-b.settings.OpenDuration)
+		b.mu.Unlock()
+	case "interval":
+		b.mu.Lock()
+		b.windowStart = b.windowStart.Add(-b.settings.Interval)
+		b.mu.Unlock()
+	default:
+		t.Fatalf("unknown step %q", op)
+	}
+}
+
+func TestBreaker(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings *Settings // testSettings when nil
+		steps    []string
+		want     State
+	}{
+		{
+			name:  "stays closed below min requests",
+			steps: []string{"fail", "fail", "fail"},
+			want:  StateClosed,
+		},
+		{
+			name:  "stays closed below the ratio",
+			steps: []string{"ok", "ok", "ok", "fail", "ok", "fail"},
+			want:  StateClosed,
+		},
+		{
+			name:  "opens at the ratio",
+			steps: []string{"ok", "fail", "ok", "fail"},
+			want:  StateOpen,
+		},
+		{
+			name:  "open rejects",
+			steps: []string{"fail", "fail", "fail", "fail", "deny"},
+			want:  StateOpen,
+		},
+		{
+			name:  "counters reset every interval",
+			steps: []string{"fail", "fail", "fail", "interval", "ok", "ok", "ok", "fail"},
+			want:  StateClosed,
+		},
+		{
+			name:  "half-open after open duration",
+			steps: []string{"fail", "fail", "fail", "fail", "wait"},
+			want:  StateHalfOpen,
+		},
+		{
+			name:  "half-open limits probes",
+			steps: []string{"fail", "fail", "fail", "fail", "wait", "hold", "hold", "deny"},
+			want:  StateHalfOpen,
+		},
+		{
+			name:  "cancelled probe frees its slot",
+			steps: []string{"fail", "fail", "fail", "fail", "wait", "hold", "cancel", "hold", "deny"},
+			want:  StateHalfOpen,
+		},
+		{
+			name:  "closes after enough successful probes",
+			steps: []string{"fail", "fail", "fail", "fail", "wait", "ok", "ok"},
+			want:  StateClosed,
+		},
+		{
+			name:  "failed probe opens again",
+			steps: []string{"fail", "fail", "fail", "fail", "wait", "ok", "fail", "deny"},
+			want:  StateOpen,
+		},
+		{
+			name:  "closed again starts from zero",
+			steps: []string{"fail", "fail", "fail", "fail", "wait", "ok", "ok", "fail", "fail", "fail"},
+			want:  StateClosed,
+		},
+		{
+			name:     "disabled",
+			settings: &Settings{MinRequests: 1, OpenDuration: time.Second},
+			steps:    []string{"fail", "fail", "fail", "fail", "fail"},
+			want:     StateClosed,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			settings := testSettings
+			if tt.settings != nil {
+				settings = *tt.settings
+			}
+			b := New(settings)
+			for _, op := range tt.steps {
+				apply(t, b, op)
+			}
+			if got := b.State(); got != tt.want {
+				t.Fatalf("state = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBreakerReady(t *testing.T) {
+	b := New(testSettings)
+	if !b.Ready() {
+		t.Fatal("closed breaker not ready")
+	}
+	for _, op := range []string{"fail", "fail", "fail", "fail"} {
+		apply(t, b, op)
+	}
+	if b.Ready() {
+		t.Fatal("open breaker ready")
+	}
+	apply(t, b, "wait")
+	apply(t, b, "hold")
+	if !b.Ready() {
+		t.Fatal("half-open breaker with a free probe slot not ready")
+	}
+	apply(t, b, "hold")
+	if b.Ready() {
+		t.Fatal("half-open breaker with all probes in flight ready")
+	}
+}
@@ -0,0 +1,35 @@
+package breaker
+
+import "sync"
+
+// Set holds one lazily created Breaker per backend ID.
+type Set struct {
+	settings Settings
+
+	mu       sync.RWMutex
+	breakers map[uint64]*Breaker
+}
+
+func NewSet(settings Settings) *Set {
+	return &Set{
+		settings: settings,
+		breakers: make(map[uint64]*Breaker),
+	}
+}
+
+func (s *Set) Get(backendID uint64) *Breaker {
+	s.mu.RLock()
+	b, ok := s.breakers[backendID]
+	s.mu.RUnlock()
+	if ok {
+		return b
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if b, ok = s.breakers[backendID]; !ok {
+		b = New(s.settings)
+		s.breakers[backendID] = b
+	}
+	return b
+}
@@ -0,0 +1,50 @@
+package conntrack
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Tracker counts in-flight requests per backend. Counters are created once
+// per backend and then updated with atomics only, so the proxy hot path
+// never takes a lock.
+type Tracker struct {
+	conns sync.Map // backend ID -> *atomic.Int64
+}
+
+func New() *Tracker {
+	return &Tracker{}
+}
+
+func (t *Tracker) Inc(backendID uint64) {
+	t.counter(backendID).Add(1)
+}
+
+func (t *Tracker) Dec(backendID uint64) {
+	t.counter(backendID).Add(-1)
+}
+
+func (t *Tracker) Load(backendID uint64) int64 {
+	c, ok := t.conns.Load(backendID)
+	if !ok {
+		return 0
+	}
+	return c.(*atomic.Int64).Load()
+}
+
+func (t *Tracker) Snapshot() map[uint64]int64 {
+	snapshot := make(map[uint64]int64)
+	t.conns.Range(func(key, value any) bool {
+		snapshot[key.(uint64)] = value.(*atomic.Int64).Load()
+		return true
+	})
+	return snapshot
+}
+
+func (t *Tracker) counter(backendID uint64) *atomic.Int64 {
+	if c, ok := t.conns.Load(backendID); ok {
+		return c.(*atomic.Int64)
+	}
+	c, _ := t.conns.LoadOrStore(backendID, new(atomic.Int64))
+	return c.(*atomic.Int64)
+}
@@ -0,0 +1,205 @@
+package strategy
+
+import (
+	"cmp"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"net"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"http-load-balancer/models"
+)
+
+const (
+	HashKeyClientID = "client_id"
+	HashKeyHeader   = "header"
+	HashKeyIP       = "ip"
+	HashKeyPath     = "path"
+
+	defaultReplicas = 160
+)
+
+// KeyFunc extracts the affinity key from a request. clientID is the ID the
+// balancer has already resolved for the request, or 0 if there is none.
+type KeyFunc func(req *http.Request, clientID uint64) string
+
+func NewKeyFunc(source, header string) (KeyFunc, error) {
+	switch source {
+	case HashKeyClientID:
+		return func(_ *http.Request, clientID uint64) string {
+			if clientID == 0 {
+				return ""
+			}
+			return strconv.FormatUint(clientID, 10)
+		}, nil
+	case HashKeyHeader:
+		if header == "" {
+			return nil, fmt.Errorf("hash key %q requires a header name", source)
+		}
+		return func(req *http.Request, _ uint64) string {
+			return req.Header.Get(header)
+		}, nil
+	case HashKeyIP:
+		return func(req *http.Request, _ uint64) string {
+			return clientIP(req)
+		}, nil
+	case HashKeyPath:
+		return func(req *http.Request, _ uint64) string {
+			return req.URL.Path
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown hash key %q", source)
+	}
+}
+
+// ringNode is one virtual node: the replica-th of the backend with the
+// given ID.
+type ringNode struct {
+	hash    uint64
+	id      uint64
+	replica int
+}
+
+// ConsistentHash maps request keys onto a hash ring with `replicas` virtual
+// nodes per backend, so adding or removing a backend only remaps ~1/N keys.
+// The ring covers every backend it is given and is only rebuilt when they
+// change; a lookup walks clockwise past nodes of backends that are not
+// routable. A backend in slow start only uses a share of its virtual nodes
+// that grows with its ramp.
+// Requests without a key (e.g. missing header) fall back to the client IP.
+type ConsistentHash struct {
+	replicas int
+	key      KeyFunc
+
+	mu        sync.RWMutex
+	ring      []ringNode
+	signature string
+}
+
+func NewConsistentHash(replicas int, key KeyFunc) *ConsistentHash {
+	if replicas <= 0 {
+		replicas = defaultReplicas
+	}
+	return &ConsistentHash{
+		replicas: replicas,
+		key:      key,
+	}
+}
+
+func (ch *ConsistentHash) NextBackend(backends []models.Backend) (models.Backend, error) {
+	return ch.NextBackendForKey(backends, "")
+}
+
+func (ch *ConsistentHash) NextBackendForRequest(
+	backends []models.Backend,
+	req *http.Request,
+	clientID uint64,
+) (models.Backend, error) {
+	key := ch.key(req, clientID)
+	if key == "" {
+		key = clientIP(req)
+	}
+	return ch.NextBackendForKey(backends, key)
+}
+
+func (ch *ConsistentHash) NextBackendForKey(backends []models.Backend, key string) (models.Backend, error) {
+	byID := make(map[uint64]models.Backend, len(backends))
+	for _, b := range backends {
+		if b.Routable() {
+			byID[b.ID] = b
+		}
+	}
+	if len(byID) == 0 {
+		return models.Backend{}, ErrNoAliveBackends
+	}
+	ring := ch.ringFor(backends)
+
+	h := hashKey(key)
+	start := sort.Search(len(ring), func(i int) bool { return ring[i].hash >= h })
+	for i := range ring {
+		node := ring[(start+i)%len(ring)]
+		b, ok := byID[node.id]
+		if ok && node.replica < ch.activeReplicas(b) {
+			return b, nil
+		}
+	}
+	return models.Backend{}, ErrNoAliveBackends
+}
+
+// activeReplicas is how many of its virtual nodes b takes keys on.
+func (ch *ConsistentHash) activeReplicas(b models.Backend) int {
+	if b.Ramp <= 0 || b.Ramp >= 1 {
+		return ch.replicas
+	}
+	return max(int(math.Ceil(float64(ch.replicas)*b.Ramp)), 1)
+}
+
+// ringFor returns the ring for backends, rebuilding it only when their IDs
+// or URLs change: routability is checked at lookup.
+func (ch *ConsistentHash) ringFor(backends []models.Backend) []ringNode {
+	members := slices.Clone(backends)
+	slices.SortFunc(members, func(a, b models.Backend) int { return cmp.Compare(a.ID, b.ID) })
+
+	var sb strings.Builder
+	for _, b := range members {
+		sb.WriteString(strconv.FormatUint(b.ID, 10))
+		sb.WriteByte('@')
+		sb.WriteString(b.URL)
+		sb.WriteByte(';')
+	}
+	signature := sb.String()
+
+	ch.mu.RLock()
+	if signature == ch.signature {
+		ring := ch.ring
+		ch.mu.RUnlock()
+		return ring
+	}
+	ch.mu.RUnlock()
+
+	ring := make([]ringNode, 0, len(members)*ch.replicas)
+	for _, b := range members {
+		for i := range ch.replicas {
+			ring = append(ring, ringNode{
+				hash:    hashKey(b.URL + "#" + strconv.Itoa(i)),
+				id:      b.ID,
+				replica: i,
+			})
+		}
+	}
+	slices.SortFunc(ring, func(a, b ringNode) int { return cmp.Compare(a.hash, b.hash) })
+
+	ch.mu.Lock()
+	ch.ring = ring
+	ch.signature = signature
+	ch.mu.Unlock()
+	return ring
+}
+
+// hashKey is FNV-1a followed by a splitmix64 finalizer, which spreads the
+// near-identical virtual node names evenly around the ring.
+func hashKey(key string) uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(key))
+	x := h.Sum64()
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+func clientIP(req *http.Request) string {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+	return host
+}
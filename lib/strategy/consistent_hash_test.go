@@ -0,0 +1,199 @@
+package strategy
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"testing"
+
+	"http-load-balancer/models"
+)
+
+func hashBackends(n int) []models.Backend {
+	backends := make([]models.Backend, 0, n)
+	for i := 1; i <= n; i++ {
+		backends = append(backends, models.Backend{
+			ID:      uint64(i),
+			URL:     fmt.Sprintf("backend%d:8080", i),
+			IsAlive: true,
+			State:   models.BackendEnabled,
+			Weight:  1,
+		})
+	}
+	return backends
+}
+
+func TestConsistentHashStableKeys(t *testing.T) {
+	ch := NewConsistentHash(160, nil)
+	backends := hashBackends(4)
+
+	for i := range 100 {
+		key := fmt.Sprintf("client-%d", i)
+		first, err := ch.NextBackendForKey(backends, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the same key keeps its backend regardless of the pool's order
+		reversed := []models.Backend{backends[3], backends[2], backends[1], backends[0]}
+		again, _ := ch.NextBackendForKey(reversed, key)
+		if again.ID != first.ID {
+			t.Fatalf("key %s moved from %d to %d", key, first.ID, again.ID)
+		}
+	}
+}
+
+func TestConsistentHashRemapsOnlyRemovedKeys(t *testing.T) {
+	ch := NewConsistentHash(160, nil)
+	backends := hashBackends(5)
+
+	const keys = 2000
+	before := make(map[string]uint64, keys)
+	for i := range keys {
+		key := fmt.Sprintf("k%d", i)
+		b, _ := ch.NextBackendForKey(backends, key)
+		before[key] = b.ID
+	}
+
+	backends[2].IsAlive = false
+	moved := 0
+	for key, id := range before {
+		b, _ := ch.NextBackendForKey(backends, key)
+		if b.ID == backends[2].ID {
+			t.Fatalf("key %s routed to a dead backend", key)
+		}
+		if id != backends[2].ID && b.ID != id {
+			moved++
+		}
+	}
+	if moved != 0 {
+		t.Fatalf("%d keys of live backends moved", moved)
+	}
+}
+
+func TestConsistentHashReturnsCurrentBackend(t *testing.T) {
+	ch := NewConsistentHash(160, nil)
+	backends := hashBackends(3)
+	first, _ := ch.NextBackendForKey(backends, "key")
+
+	// an admin change that doesn't alter the ring must still show up
+	for i := range backends {
+		backends[i].MaxRPS = 50
+		backends[i].Weight = 7
+	}
+	b, _ := ch.NextBackendForKey(backends, "key")
+	if b.ID != first.ID {
+		t.Fatalf("key moved from %d to %d", first.ID, b.ID)
+	}
+	if b.MaxRPS != 50 || b.Weight != 7 {
+		t.Fatalf("got a stale backend: max_rps %d, weight %d", b.MaxRPS, b.Weight)
+	}
+
+	// a backend re-added under the same URL has a new ID
+	backends[0].ID = 100
+	for i := range 50 {
+		b, _ := ch.NextBackendForKey(backends, fmt.Sprintf("k%d", i))
+		if b.ID == 1 {
+			t.Fatal("got a backend that was removed")
+		}
+	}
+}
+
+func TestConsistentHashSlowStart(t *testing.T) {
+	ch := NewConsistentHash(160, nil)
+	backends := hashBackends(4)
+	backends[3].Ramp = 0.1
+
+	const keys = 10000
+	hits := 0
+	for i := range keys {
+		b, _ := ch.NextBackendForKey(backends, fmt.Sprintf("k%d", i))
+		if b.ID == backends[3].ID {
+			hits++
+		}
+	}
+	// a full share would be about a quarter
+	if share := float64(hits) / keys; share > 0.08 {
+		t.Fatalf("backend in slow start got %.2f of keys", share)
+	}
+}
+
+func TestConsistentHashKeepsRing(t *testing.T) {
+	ch := NewConsistentHash(160, nil)
+	backends := hashBackends(4)
+	if _, err := ch.NextBackendForKey(backends, "key"); err != nil {
+		t.Fatal(err)
+	}
+	ring := &ch.ring[0]
+
+	// only the routable subset changes
+	backends[0].Tried = true
+	backends[1].CircuitOpen = true
+	backends[2].Saturated = true
+	backends[3].Ramp = 0.5
+	for i := range 50 {
+		b, err := ch.NextBackendForKey(backends, fmt.Sprintf("k%d", i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if b.ID != backends[3].ID {
+			t.Fatalf("key routed to non-routable backend %d", b.ID)
+		}
+	}
+	if &ch.ring[0] != ring {
+		t.Fatal("ring rebuilt although membership didn't change")
+	}
+
+	backends = append(backends, hashBackends(5)[4])
+	if _, err := ch.NextBackendForKey(backends, "key"); err != nil {
+		t.Fatal(err)
+	}
+	if &ch.ring[0] == ring {
+		t.Fatal("ring not rebuilt for a new backend")
+	}
+}
+
+func TestConsistentHashNoBackends(t *testing.T) {
+	ch := NewConsistentHash(160, nil)
+	backends := hashBackends(2)
+	for i := range backends {
+		backends[i].State = models.BackendDraining
+	}
+	if _, err := ch.NextBackendForKey(backends, "key"); err != ErrNoAliveBackends {
+		t.Fatalf("err = %v, want ErrNoAliveBackends", err)
+	}
+}
+
+func TestNewKeyFunc(t *testing.T) {
+	req := httptest.NewRequest("GET", "/orders/7", nil)
+	req.RemoteAddr = "10.1.2.3:5555"
+	req.Header.Set("X-Session-ID", "abc")
+
+	tests := []struct {
+		source   string
+		header   string
+		clientID uint64
+		want     string
+		wantErr  bool
+	}{
+		{source: HashKeyClientID, clientID: 42, want: "42"},
+		{source: HashKeyClientID, want: ""},
+		{source: HashKeyHeader, header: "X-Session-ID", want: "abc"},
+		{source: HashKeyHeader, wantErr: true},
+		{source: HashKeyIP, want: "10.1.2.3"},
+		{source: HashKeyPath, want: "/orders/7"},
+		{source: "cookie", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.source+"/"+tt.header, func(t *testing.T) {
+			key, err := NewKeyFunc(tt.source, tt.header)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got := key(req, tt.clientID); got != tt.want {
+				t.Fatalf("key = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
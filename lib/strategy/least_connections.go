@@ -2,41 +2,39 @@ package strategy
 
 import (
 	"errors"
-	"sync"
 
+	"http-load-balancer/lib/conntrack"
 	"http-load-balancer/models"
 )
 
 type LeastConnections struct {
-	mu *sync.RWMutex
+	conns *conntrack.Tracker
 }
 
-func NewLeastConnections(backends []models.Backend) (*LeastConnections, error) {
+func NewLeastConnections(backends []models.Backend, conns *conntrack.Tracker) (*LeastConnections, error) {
 	if len(backends) == 0 {
-		return &LeastConnections{}, errors.New("no URLs provided")
+		return &LeastConnections{conns: conns}, errors.New("no URLs provided")
 	}
 	return &LeastConnections{
-		mu: new(sync.RWMutex),
+		conns: conns,
 	}, nil
 }
 
 func (lc *LeastConnections) NextBackend(backends []models.Backend) (models.Backend, error) {
-	var minConns = -1
+	var minConns int64 = -1
 	var selected models.Backend
 	found := false
 
-	lc.mu.Lock()
-	for _, b := range backends {
-		if !b.IsAlive {
-			continue
-		}
-		if minConns == -1 || b.ActiveConns < minConns {
-			minConns = b.ActiveConns
+	// without routable a backend back from slow start would take every
+	// request until it caught up with the others' connections
+	for _, b := range routable(backends) {
+		conns := lc.conns.Load(b.ID)
+		if minConns == -1 || conns < minConns {
+			minConns = conns
 			selected = b
 			found = true
 		}
 	}
-	lc.mu.Unlock()
 
 	if !found {
 		return models.Backend{}, ErrNoAliveBackends
@@ -0,0 +1,122 @@
+package strategy
+
+import (
+	"math"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"http-load-balancer/lib/conntrack"
+	"http-load-balancer/models"
+)
+
+const defaultDecay = 10 * time.Second
+
+type ewma struct {
+	value   float64 // nanoseconds
+	updated time.Time
+}
+
+// P2CEWMA picks two alive backends at random and routes to the one with
+// the lower cost, where cost is the EWMA of the time to response headers
+// scaled by in-flight requests. Backends without samples yet are cheapest,
+// so new members get probed right away. Samples of backends that left the
+// pool are dropped.
+type P2CEWMA struct {
+	conns *conntrack.Tracker
+	decay time.Duration
+
+	mu    sync.Mutex
+	stats map[uint64]*ewma
+}
+
+func NewP2CEWMA(conns *conntrack.Tracker, decay time.Duration) *P2CEWMA {
+	if decay <= 0 {
+		decay = defaultDecay
+	}
+	return &P2CEWMA{
+		conns: conns,
+		decay: decay,
+		stats: make(map[uint64]*ewma),
+	}
+}
+
+func (p *P2CEWMA) NextBackend(backends []models.Backend) (models.Backend, error) {
+	p.prune(backends)
+	alive := routable(backends)
+
+	switch len(alive) {
+	case 0:
+		return models.Backend{}, ErrNoAliveBackends
+	case 1:
+		return alive[0], nil
+	}
+
+	i := rand.IntN(len(alive))
+	j := rand.IntN(len(alive) - 1)
+	if j >= i {
+		j++
+	}
+
+	a, b := alive[i], alive[j]
+	if p.cost(b.ID) < p.cost(a.ID) {
+		return b, nil
+	}
+	return a, nil
+}
+
+// prune forgets the samples of backends that are no longer in the pool.
+func (p *P2CEWMA) prune(backends []models.Backend) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	known := 0
+	for _, b := range backends {
+		if _, ok := p.stats[b.ID]; ok {
+			known++
+		}
+	}
+	if known == len(p.stats) {
+		return
+	}
+	pool := make(map[uint64]struct{}, len(backends))
+	for _, b := range backends {
+		pool[b.ID] = struct{}{}
+	}
+	for id := range p.stats {
+		if _, ok := pool[id]; !ok {
+			delete(p.stats, id)
+		}
+	}
+}
+
+// ObserveLatency folds a response time into the backend's EWMA. The weight
+// of the new sample depends on how long ago the previous one arrived, so
+// the average forgets at the same rate regardless of traffic volume.
+func (p *P2CEWMA) ObserveLatency(backendID uint64, latency time.Duration) {
+	now := time.Now()
+	sample := float64(latency)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	s, ok := p.stats[backendID]
+	if !ok {
+		p.stats[backendID] = &ewma{value: sample, updated: now}
+		return
+	}
+	alpha := 1 - math.Exp(-float64(now.Sub(s.updated))/float64(p.decay))
+	s.value += alpha * (sample - s.value)
+	s.updated = now
+}
+
+func (p *P2CEWMA) cost(backendID uint64) float64 {
+	p.mu.Lock()
+	var latency float64
+	if s, ok := p.stats[backendID]; ok {
+		latency = s.value
+	}
+	p.mu.Unlock()
+
+	return (latency + 1) * float64(p.conns.Load(backendID)+1)
+}
@@ -0,0 +1,43 @@
+package strategy
+
+import (
+	"testing"
+	"time"
+
+	"http-load-balancer/lib/conntrack"
+)
+
+func TestP2CEWMAPrunesRemovedBackends(t *testing.T) {
+	p := NewP2CEWMA(conntrack.New(), time.Second)
+	backends := hashBackends(3)
+	for _, b := range backends {
+		p.ObserveLatency(b.ID, 10*time.Millisecond)
+	}
+
+	if _, err := p.NextBackend(backends[:2]); err != nil {
+		t.Fatal(err)
+	}
+	if len(p.stats) != 2 {
+		t.Fatalf("stats kept for %d backends, want 2", len(p.stats))
+	}
+	if _, ok := p.stats[backends[2].ID]; ok {
+		t.Fatal("stats of a removed backend were kept")
+	}
+}
+
+func TestP2CEWMAPrefersFaster(t *testing.T) {
+	p := NewP2CEWMA(conntrack.New(), time.Second)
+	backends := hashBackends(2)
+	p.ObserveLatency(backends[0].ID, 100*time.Millisecond)
+	p.ObserveLatency(backends[1].ID, time.Millisecond)
+
+	for range 20 {
+		b, err := p.NextBackend(backends)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if b.ID != backends[1].ID {
+			t.Fatalf("picked backend %d, want the faster %d", b.ID, backends[1].ID)
+		}
+	}
+}
@@ -14,12 +14,7 @@ func NewRandom() *Random {
 }
 
 func (r *Random) NextBackend(backends []models.Backend) (models.Backend, error) {
-	aliveBackends := make([]models.Backend, 0, len(backends))
-	for _, b := range backends {
-		if b.IsAlive {
-			aliveBackends = append(aliveBackends, b)
-		}
-	}
+	aliveBackends := routable(backends)
 
 	// generate crypto-safety random number
 	var n uint32
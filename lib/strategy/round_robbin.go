@@ -15,17 +15,7 @@ func NewRoundRobin() *RoundRobin {
 }
 
 func (rr *RoundRobin) NextBackend(backends []models.Backend) (models.Backend, error) {
-	if len(backends) == 0 {
-		return models.Backend{}, nil
-	}
-
-	activeBackends := make([]models.Backend, 0)
-	for _, backend := range backends {
-		if backend.IsAlive {
-			activeBackends = append(activeBackends, backend)
-		}
-	}
-
+	activeBackends := routable(backends)
 	if len(activeBackends) == 0 {
 		return models.Backend{}, ErrNoAliveBackends
 	}
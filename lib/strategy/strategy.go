@@ -2,6 +2,9 @@ package strategy
 
 import (
 	"errors"
+	"math/rand/v2"
+	"net/http"
+	"time"
 
 	"http-load-balancer/models"
 )
@@ -10,6 +13,40 @@ type Strategy interface {
 	NextBackend(backends []models.Backend) (models.Backend, error)
 }
 
+// RequestStrategy is implemented by strategies that pick a backend based on
+// the request itself (e.g. for affinity) rather than on pool state alone.
+type RequestStrategy interface {
+	NextBackendForRequest(backends []models.Backend, req *http.Request, clientID uint64) (models.Backend, error)
+}
+
+// LatencyObserver is implemented by strategies that learn from the response
+// times the balancer measures.
+type LatencyObserver interface {
+	ObserveLatency(backendID uint64, latency time.Duration)
+}
+
 var (
 	ErrNoAliveBackends = errors.New("no alive backends")
 )
+
+// routable returns the backends a strategy without weights may pick from.
+// A backend in slow start is left out at random with the probability of
+// the part of its ramp still to go, which cuts its share of picks
+// accordingly. If that leaves nothing, all routable backends are returned.
+func routable(backends []models.Backend) []models.Backend {
+	all := make([]models.Backend, 0, len(backends))
+	picked := make([]models.Backend, 0, len(backends))
+	for _, b := range backends {
+		if !b.Routable() {
+			continue
+		}
+		all = append(all, b)
+		if b.Ramp <= 0 || b.Ramp >= 1 || rand.Float64() < b.Ramp {
+			picked = append(picked, b)
+		}
+	}
+	if len(picked) == 0 {
+		return all
+	}
+	return picked
+}
@@ -0,0 +1,60 @@
+package strategy
+
+import (
+	"sync"
+
+	"http-load-balancer/models"
+)
+
+// weightScale multiplies backend weights so that slow start can ramp them
+// in small steps.
+const weightScale = 100
+
+// WeightedRoundRobin implements nginx-style smooth weighted round-robin:
+// a backend with weight 5 gets five picks out of every sum(weights),
+// interleaved with the others instead of sent in a single burst.
+type WeightedRoundRobin struct {
+	mu      sync.Mutex
+	current map[uint64]int
+}
+
+func NewWeightedRoundRobin() *WeightedRoundRobin {
+	return &WeightedRoundRobin{
+		current: make(map[uint64]int),
+	}
+}
+
+func (wrr *WeightedRoundRobin) NextBackend(backends []models.Backend) (models.Backend, error) {
+	wrr.mu.Lock()
+	defer wrr.mu.Unlock()
+
+	var selected *models.Backend
+	total := 0
+	seen := make(map[uint64]struct{}, len(backends))
+	for i := range backends {
+		b := &backends[i]
+		if !b.Routable() {
+			continue
+		}
+		weight := max(int(b.EffectiveWeight()*weightScale), 1)
+		seen[b.ID] = struct{}{}
+		wrr.current[b.ID] += weight
+		total += weight
+		if selected == nil || wrr.current[b.ID] > wrr.current[selected.ID] {
+			selected = b
+		}
+	}
+
+	// forget backends that left the pool so they rejoin with a clean state
+	for id := range wrr.current {
+		if _, ok := seen[id]; !ok {
+			delete(wrr.current, id)
+		}
+	}
+
+	if selected == nil {
+		return models.Backend{}, ErrNoAliveBackends
+	}
+	wrr.current[selected.ID] -= total
+	return *selected, nil
+}
@@ -0,0 +1,85 @@
+package strategy
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"http-load-balancer/models"
+)
+
+func wrrBackend(id uint64, name string, weight int) models.Backend {
+	return models.Backend{
+		ID:      id,
+		URL:     name,
+		IsAlive: true,
+		State:   models.BackendEnabled,
+		Weight:  weight,
+	}
+}
+
+func TestWeightedRoundRobinSequence(t *testing.T) {
+	disabled := wrrBackend(3, "c", 1)
+	disabled.State = models.BackendDisabled
+
+	tests := []struct {
+		name     string
+		backends []models.Backend
+		want     string // one cycle of picks
+	}{
+		{
+			name:     "smooth 5/1/1",
+			backends: []models.Backend{wrrBackend(1, "a", 5), wrrBackend(2, "b", 1), wrrBackend(3, "c", 1)},
+			want:     "aabacaa",
+		},
+		{
+			name:     "zero weight counts as 1",
+			backends: []models.Backend{wrrBackend(1, "a", 2), wrrBackend(2, "b", 0)},
+			want:     "aba",
+		},
+		{
+			name:     "disabled backend is skipped",
+			backends: []models.Backend{wrrBackend(1, "a", 2), wrrBackend(2, "b", 1), disabled},
+			want:     "aba",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wrr := NewWeightedRoundRobin()
+			for cycle := range 3 {
+				var got strings.Builder
+				for range len(tt.want) {
+					b, err := wrr.NextBackend(tt.backends)
+					if err != nil {
+						t.Fatal(err)
+					}
+					got.WriteString(b.URL)
+				}
+				if got.String() != tt.want {
+					t.Fatalf("cycle %d = %q, want %q", cycle, got.String(), tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestWeightedRoundRobinNoBackends(t *testing.T) {
+	dead := wrrBackend(1, "a", 1)
+	dead.IsAlive = false
+
+	tests := []struct {
+		name     string
+		backends []models.Backend
+	}{
+		{name: "empty", backends: nil},
+		{name: "none routable", backends: []models.Backend{dead}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewWeightedRoundRobin().NextBackend(tt.backends)
+			if !errors.Is(err, ErrNoAliveBackends) {
+				t.Fatalf("err = %v, want ErrNoAliveBackends", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,223 @@
+package limiter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type concurrencyEntry struct {
+	ready   chan struct{}
+	loadErr error
+
+	stale atomic.Bool // the limit is reloaded before the next acquire
+
+	mu      sync.Mutex
+	limit   int // 0 when the client has no max_concurrent
+	active  int
+	waiting int
+	freed   chan struct{} // closed and replaced when a slot frees up or the limit changes
+	removed bool          // dropped from the map, acquire through a new entry
+}
+
+// take claims a slot if one is free. e.mu must be held.
+func (e *concurrencyEntry) take() bool {
+	if e.limit > 0 && e.active >= e.limit {
+		return false
+	}
+	e.active++
+	return true
+}
+
+func (e *concurrencyEntry) release() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.active--
+	e.wake()
+}
+
+// wake lets queued requests check for a slot again. e.mu must be held.
+func (e *concurrencyEntry) wake() {
+	close(e.freed)
+	e.freed = make(chan struct{})
+}
+
+// Concurrency caps the number of requests a client may have in flight at
+// once. Requests over the cap wait in a short per-client queue for up to
+// queueTimeout; when the queue is full they are rejected right away.
+type Concurrency struct {
+	plans        *PlanResolver
+	maxQueue     int
+	queueTimeout time.Duration
+
+	entries sync.Map // client ID -> *concurrencyEntry
+}
+
+func NewConcurrency(plans *PlanResolver, maxQueue int, queueTimeout time.Duration) *Concurrency {
+	return &Concurrency{
+		plans:        plans,
+		maxQueue:     maxQueue,
+		queueTimeout: queueTimeout,
+	}
+}
+
+// Acquire takes one of the client's slots, waiting in the queue if all of
+// them are busy. The returned func gives the slot back and must be called
+// exactly once when the request is done.
+func (c *Concurrency) Acquire(ctx context.Context, userID uint64) (func(), error) {
+	const op = "Concurrency.Acquire"
+
+	for {
+		e, err := c.entry(userID)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		release, err := c.acquire(ctx, e)
+		if errors.Is(err, errEntryRemoved) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		return release, nil
+	}
+}
+
+var errEntryRemoved = errors.New("concurrency entry removed")
+
+func (c *Concurrency) acquire(ctx context.Context, e *concurrencyEntry) (func(), error) {
+	e.mu.Lock()
+	if e.removed {
+		e.mu.Unlock()
+		return nil, errEntryRemoved
+	}
+	if e.take() {
+		e.mu.Unlock()
+		return e.release, nil
+	}
+	if e.waiting >= c.maxQueue {
+		e.mu.Unlock()
+		return nil, ErrConcurrencyLimit
+	}
+	e.waiting++
+	e.mu.Unlock()
+
+	defer func() {
+		e.mu.Lock()
+		e.waiting--
+		e.mu.Unlock()
+	}()
+
+	timer := time.NewTimer(c.queueTimeout)
+	defer timer.Stop()
+
+	for {
+		e.mu.Lock()
+		if e.take() {
+			e.mu.Unlock()
+			return e.release, nil
+		}
+		freed := e.freed
+		e.mu.Unlock()
+
+		select {
+		case <-freed:
+		case <-timer.C:
+			return nil, ErrQueueTimeout
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// InFlight reports how many of the client's requests currently hold a slot
+// and how many are queued.
+func (c *Concurrency) InFlight(userID uint64) (active, queued int) {
+	v, ok := c.entries.Load(userID)
+	if !ok {
+		return 0, 0
+	}
+	e := v.(*concurrencyEntry)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.active, e.waiting
+}
+
+// Forget drops a client's cached limit after it was changed or the client
+// was deleted. Requests holding a slot keep it and queued ones keep
+// waiting; the new limit applies from the next acquire on.
+func (c *Concurrency) Forget(userID uint64) {
+	v, ok := c.entries.Load(userID)
+	if !ok {
+		return
+	}
+	e := v.(*concurrencyEntry)
+	e.stale.Store(true)
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.active == 0 && e.waiting == 0 {
+		e.removed = true
+		c.entries.CompareAndDelete(userID, e)
+	}
+}
+
+// ForgetAll drops the cached limits of every client.
+func (c *Concurrency) ForgetAll() {
+	c.entries.Range(func(key, _ any) bool {
+		c.Forget(key.(uint64))
+		return true
+	})
+}
+
+func (c *Concurrency) entry(userID uint64) (*concurrencyEntry, error) {
+	v, loaded := c.entries.LoadOrStore(userID, &concurrencyEntry{ready: make(chan struct{})})
+	e := v.(*concurrencyEntry)
+	if !loaded {
+		c.load(userID, e)
+	}
+
+	<-e.ready
+	if e.loadErr != nil {
+		return nil, e.loadErr
+	}
+	if e.stale.CompareAndSwap(true, false) {
+		if err := c.reload(userID, e); err != nil {
+			e.stale.Store(true)
+			return nil, err
+		}
+	}
+	return e, nil
+}
+
+func (c *Concurrency) load(userID uint64, e *concurrencyEntry) {
+	defer close(e.ready)
+
+	_, limits, err := c.plans.Resolve(userID)
+	if err != nil {
+		e.loadErr = err
+		c.entries.CompareAndDelete(userID, e)
+		return
+	}
+	e.limit = max(limits.MaxConcurrent, 0)
+	e.freed = make(chan struct{})
+}
+
+// reload applies a changed limit to an entry that requests may be holding
+// slots of.
+func (c *Concurrency) reload(userID uint64, e *concurrencyEntry) error {
+	_, limits, err := c.plans.Resolve(userID)
+	if err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.limit = max(limits.MaxConcurrent, 0)
+	e.wake()
+	return nil
+}
@@ -0,0 +1,184 @@
+package limiter
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"http-load-balancer/models"
+	"http-load-balancer/repository"
+)
+
+func newTestConcurrency(maxConcurrent, maxQueue int) (*Concurrency, *fakePlans) {
+	users := newFakeUsers(models.User{ID: 1})
+	plans := newFakePlans(models.Plan{
+		ID:            1,
+		Name:          DefaultPlan,
+		Capacity:      10,
+		RatePerSec:    1,
+		MaxConcurrent: maxConcurrent,
+	})
+	return NewConcurrency(NewPlanResolver(users, plans, false), maxQueue, 10*time.Millisecond), plans
+}
+
+// setMaxConcurrent changes the default plan like an admin edit would.
+func setMaxConcurrent(plans *fakePlans, n int) {
+	plan := plans.plans[DefaultPlan]
+	plan.MaxConcurrent = n
+	plans.plans[DefaultPlan] = plan
+}
+
+func TestConcurrencyForgetKeepsHeldSlots(t *testing.T) {
+	c, plans := newTestConcurrency(2, 0)
+	ctx := context.Background()
+
+	var releases []func()
+	for range 2 {
+		release, err := c.Acquire(ctx, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		releases = append(releases, release)
+	}
+
+	// the limit is lowered while both slots are held
+	setMaxConcurrent(plans, 1)
+	c.Forget(1)
+	if active, _ := c.InFlight(1); active != 2 {
+		t.Fatalf("active after Forget = %d, want 2", active)
+	}
+	if _, err := c.Acquire(ctx, 1); !errors.Is(err, ErrConcurrencyLimit) {
+		t.Fatalf("err = %v, want ErrConcurrencyLimit", err)
+	}
+
+	// one release still leaves the client at the new limit
+	releases[0]()
+	if _, err := c.Acquire(ctx, 1); !errors.Is(err, ErrConcurrencyLimit) {
+		t.Fatalf("err = %v, want ErrConcurrencyLimit", err)
+	}
+	releases[1]()
+	release, err := c.Acquire(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if active, _ := c.InFlight(1); active != 1 {
+		t.Fatalf("active = %d, want 1", active)
+	}
+	release()
+}
+
+func TestConcurrencyAcquire(t *testing.T) {
+	tests := []struct {
+		name          string
+		maxConcurrent int
+		maxQueue      int
+		held          int // slots taken before the checked acquire
+		ctx           func() context.Context
+		wantErr       error
+	}{
+		{name: "free slot", maxConcurrent: 2, held: 1},
+		{name: "unlimited", maxConcurrent: 0, held: 50},
+		{name: "queue full", maxConcurrent: 1, maxQueue: 0, held: 1, wantErr: ErrConcurrencyLimit},
+		{name: "queue timeout", maxConcurrent: 1, maxQueue: 1, held: 1, wantErr: ErrQueueTimeout},
+		{
+			name:          "client gives up",
+			maxConcurrent: 1,
+			maxQueue:      1,
+			held:          1,
+			ctx: func() context.Context {
+				ctx, cancel := context.WithCancel(context.Background())
+				cancel()
+				return ctx
+			},
+			wantErr: context.Canceled,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := newTestConcurrency(tt.maxConcurrent, tt.maxQueue)
+			for range tt.held {
+				if _, err := c.Acquire(context.Background(), 1); err != nil {
+					t.Fatal(err)
+				}
+			}
+			ctx := context.Background()
+			if tt.ctx != nil {
+				ctx = tt.ctx()
+			}
+
+			release, err := c.Acquire(ctx, 1)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil {
+				release()
+			}
+			if active, queued := c.InFlight(1); active != tt.held || queued != 0 {
+				t.Fatalf("InFlight() = %d, %d, want %d, 0", active, queued, tt.held)
+			}
+		})
+	}
+}
+
+func TestConcurrencyQueuedGetsReleasedSlot(t *testing.T) {
+	c, _ := newTestConcurrency(1, 1)
+	c.queueTimeout = time.Second
+	release, err := c.Acquire(context.Background(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	acquired := make(chan error, 1)
+	go func() {
+		release, err := c.Acquire(context.Background(), 1)
+		if err == nil {
+			release()
+		}
+		acquired <- err
+	}()
+	for {
+		if _, queued := c.InFlight(1); queued == 1 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	release()
+	if err := <-acquired; err != nil {
+		t.Fatalf("queued request failed: %v", err)
+	}
+	if active, queued := c.InFlight(1); active != 0 || queued != 0 {
+		t.Fatalf("InFlight() = %d, %d, want 0, 0", active, queued)
+	}
+}
+
+func TestConcurrencyForgetIdleClient(t *testing.T) {
+	c, plans := newTestConcurrency(1, 0)
+	release, err := c.Acquire(context.Background(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	release()
+
+	setMaxConcurrent(plans, 2)
+	c.Forget(1)
+	if _, ok := c.entries.Load(uint64(1)); ok {
+		t.Fatal("entry of an idle client kept after Forget")
+	}
+	for range 2 {
+		if _, err := c.Acquire(context.Background(), 1); err != nil {
+			t.Fatalf("new limit not applied: %v", err)
+		}
+	}
+}
+
+func TestConcurrencyUnknownClient(t *testing.T) {
+	c, _ := newTestConcurrency(1, 0)
+	if _, err := c.Acquire(context.Background(), 42); !errors.Is(err, repository.ErrUserNotFound) {
+		t.Fatalf("err = %v, want ErrUserNotFound", err)
+	}
+	if _, ok := c.entries.Load(uint64(42)); ok {
+		t.Fatal("failed load left an entry behind")
+	}
+}
@@ -0,0 +1,32 @@
+package limiter
+
+import (
+	"math"
+	"time"
+)
+
+// Decision is the outcome of a limiter check, carrying enough state for
+// the caller to tell clients when to come back.
+type Decision struct {
+	Allowed bool
+	// Limit is the bucket capacity.
+	Limit int
+	// Remaining whole requests the client can make right now.
+	Remaining int
+	// Reset is the time until the bucket is full again.
+	Reset time.Duration
+	// RetryAfter is the time until the next request would be allowed;
+	// zero when Allowed.
+	RetryAfter time.Duration
+	// Shadow is set for clients in shadow mode: the decision is to be
+	// recorded but not enforced.
+	Shadow bool
+	// Priority of the client, which decides who is shed first once the
+	// balancer nears its global rate limit.
+	Priority int
+}
+
+// Seconds rounds d up to whole seconds, as used by HTTP headers.
+func Seconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
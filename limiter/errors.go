@@ -3,5 +3,8 @@ package limiter
 import "errors"
 
 var (
-	ErrRateLimitExceeded = errors.New("rate limit exceeded")
+	ErrUnknownAlgorithm   = errors.New("unknown rate limit algorithm")
+	ErrUnknownQuotaPeriod = errors.New("unknown quota period")
+	ErrConcurrencyLimit   = errors.New("too many concurrent requests")
+	ErrQueueTimeout       = errors.New("timed out waiting for a concurrency slot")
 )
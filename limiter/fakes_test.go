@@ -0,0 +1,150 @@
+package limiter
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"http-load-balancer/models"
+	"http-load-balancer/repository"
+)
+
+// fakeUsers serves clients from memory; only the methods the limiters use
+// are implemented.
+type fakeUsers struct {
+	repository.UserRepository
+
+	mu      sync.Mutex
+	users   map[uint64]models.User
+	lookups int
+	flushed []repository.TokensUpdate
+}
+
+func newFakeUsers(users ...models.User) *fakeUsers {
+	f := &fakeUsers{users: make(map[uint64]models.User)}
+	for _, u := range users {
+		f.users[u.ID] = u
+	}
+	return f
+}
+
+func (f *fakeUsers) GetByID(id uint64) (models.User, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.lookups++
+	u, ok := f.users[id]
+	if !ok {
+		return models.User{}, fmt.Errorf("fakeUsers.GetByID: %w", repository.ErrUserNotFound)
+	}
+	return u, nil
+}
+
+func (f *fakeUsers) UpdateTokensBatch(updates []repository.TokensUpdate) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, u := range updates {
+		user := f.users[u.ID]
+		user.Tokens = u.Tokens
+		user.LastUpdated = u.LastUpdated.Format(time.RFC3339Nano)
+		f.users[u.ID] = user
+	}
+	f.flushed = append(f.flushed, updates...)
+	return nil
+}
+
+type fakePlans struct {
+	repository.PlanRepository
+	plans map[string]models.Plan
+}
+
+func newFakePlans(plans ...models.Plan) *fakePlans {
+	f := &fakePlans{plans: make(map[string]models.Plan)}
+	for _, p := range plans {
+		f.plans[p.Name] = p
+	}
+	return f
+}
+
+func (f *fakePlans) GetByID(id uint64) (models.Plan, error) {
+	for _, p := range f.plans {
+		if p.ID == id {
+			return p, nil
+		}
+	}
+	return models.Plan{}, repository.ErrPlanNotFound
+}
+
+func (f *fakePlans) GetByName(name string) (models.Plan, error) {
+	p, ok := f.plans[name]
+	if !ok {
+		return models.Plan{}, repository.ErrPlanNotFound
+	}
+	return p, nil
+}
+
+type usageKeyFake struct {
+	clientID    uint64
+	period      string
+	windowStart time.Time
+}
+
+// fakeUsage behaves like client_usage, including rejecting a batch that
+// touches the same counter twice like INSERT ... ON CONFLICT does and
+// dropping counts of deleted clients.
+type fakeUsage struct {
+	mu       sync.Mutex
+	counters map[usageKeyFake]int64
+	deleted  map[uint64]bool
+}
+
+func newFakeUsage() *fakeUsage {
+	return &fakeUsage{
+		counters: make(map[usageKeyFake]int64),
+		deleted:  make(map[uint64]bool),
+	}
+}
+
+// deleteClient removes a client's counters like the ON DELETE CASCADE.
+func (f *fakeUsage) deleteClient(id uint64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.deleted[id] = true
+	for key := range f.counters {
+		if key.clientID == id {
+			delete(f.counters, key)
+		}
+	}
+}
+
+func (f *fakeUsage) Get(clientID uint64, period string, windowStart time.Time) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.counters[usageKeyFake{clientID, period, windowStart.UTC()}], nil
+}
+
+func (f *fakeUsage) AddBatch(increments []repository.UsageIncrement) ([]uint64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	seen := make(map[usageKeyFake]struct{}, len(increments))
+	for _, inc := range increments {
+		key := usageKeyFake{inc.ClientID, inc.Period, inc.WindowStart.UTC()}
+		if _, ok := seen[key]; ok {
+			return nil, errors.New("ON CONFLICT DO UPDATE command cannot affect row a second time")
+		}
+		seen[key] = struct{}{}
+	}
+	var dropped []uint64
+	for _, inc := range increments {
+		if f.deleted[inc.ClientID] {
+			dropped = append(dropped, inc.ClientID)
+			continue
+		}
+		f.counters[usageKeyFake{inc.ClientID, inc.Period, inc.WindowStart.UTC()}] += inc.Requests
+	}
+	return dropped, nil
+}
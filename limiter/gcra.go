@@ -0,0 +1,49 @@
+package limiter
+
+import "time"
+
+// GCRA is the generic cell rate algorithm: it allows the same traffic as a
+// token bucket but keeps a single timestamp (the theoretical arrival time)
+// instead of a token count.
+type GCRA struct {
+	capacity  float64
+	emission  time.Duration // time one request "costs"
+	tolerance time.Duration // how far ahead of now tat may run
+	tat       time.Time
+}
+
+func NewGCRA(capacity, rate float64) *GCRA {
+	emission := time.Duration(float64(time.Second) / rate)
+	return &GCRA{
+		capacity:  capacity,
+		emission:  emission,
+		tolerance: time.Duration(capacity) * emission,
+	}
+}
+
+func (g *GCRA) Allow(now time.Time, n int) Decision {
+	cost := min(float64(n), g.capacity)
+	tat := g.tat
+	if tat.Before(now) {
+		tat = now
+	}
+
+	newTat := tat.Add(time.Duration(cost * float64(g.emission)))
+	allowAt := newTat.Add(-g.tolerance)
+	allowed := !allowAt.After(now)
+	if allowed {
+		g.tat = newTat
+		tat = newTat
+	}
+
+	d := Decision{
+		Allowed:   allowed,
+		Limit:     int(g.capacity),
+		Remaining: max(int((g.tolerance-tat.Sub(now))/g.emission), 0),
+		Reset:     tat.Sub(now),
+	}
+	if !allowed {
+		d.RetryAfter = allowAt.Sub(now)
+	}
+	return d
+}
@@ -0,0 +1,52 @@
+package limiter
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	AlgorithmTokenBucket          = "token_bucket"
+	AlgorithmGCRA                 = "gcra"
+	AlgorithmSlidingWindowLog     = "sliding_window_log"
+	AlgorithmSlidingWindowCounter = "sliding_window_counter"
+)
+
+// Limiter is the rate limiting state of a single client. Every algorithm
+// is configured by the client's capacity and rate: bursts of up to
+// capacity requests, refilled at rate per second. Window based algorithms
+// translate that into "capacity requests per capacity/rate seconds".
+//
+// Allow charges n tokens (requests, for window based algorithms). A cost
+// above capacity is charged as capacity, so that such requests are still
+// possible with a full bucket.
+//
+// Implementations are not safe for concurrent use; Store serializes calls
+// per client.
+type Limiter interface {
+	Allow(now time.Time, n int) Decision
+}
+
+func ValidateAlgorithm(algorithm string) error {
+	switch algorithm {
+	case AlgorithmTokenBucket, AlgorithmGCRA, AlgorithmSlidingWindowLog, AlgorithmSlidingWindowCounter:
+		return nil
+	default:
+		return fmt.Errorf("%w: %q", ErrUnknownAlgorithm, algorithm)
+	}
+}
+
+func newLimiter(algorithm string, capacity, rate float64, window time.Duration, now time.Time) (Limiter, error) {
+	switch algorithm {
+	case AlgorithmTokenBucket, "":
+		return NewTokenBucket(capacity, rate, capacity, now), nil
+	case AlgorithmGCRA:
+		return NewGCRA(capacity, rate), nil
+	case AlgorithmSlidingWindowLog:
+		return NewSlidingWindowLog(capacity, window), nil
+	case AlgorithmSlidingWindowCounter:
+		return NewSlidingWindowCounter(capacity, window), nil
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownAlgorithm, algorithm)
+	}
+}
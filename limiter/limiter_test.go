@@ -0,0 +1,131 @@
+package limiter
+
+import (
+	"testing"
+	"time"
+
+	"http-load-balancer/models"
+)
+
+// step is one request at offset at from the start of a test.
+type step struct {
+	at         time.Duration
+	n          int
+	allowed    bool
+	remaining  int
+	retryAfter time.Duration
+}
+
+func runSteps(t *testing.T, l Limiter, steps []step) {
+	t.Helper()
+	// a multiple of every window used, so fixed windows start at t0
+	t0 := time.Unix(1_200_000, 0)
+	for i, s := range steps {
+		d := l.Allow(t0.Add(s.at), s.n)
+		// retry times come from float math and may be off by a few ns
+		off := (d.RetryAfter - s.retryAfter).Abs()
+		if d.Allowed != s.allowed || d.Remaining != s.remaining || off > time.Microsecond {
+			t.Fatalf("step %d at %v: got allowed %v, remaining %d, retry after %v; want %v, %d, %v",
+				i, s.at, d.Allowed, d.Remaining, d.RetryAfter, s.allowed, s.remaining, s.retryAfter)
+		}
+	}
+}
+
+func TestAlgorithms(t *testing.T) {
+	tests := []struct {
+		name    string
+		limiter func() Limiter
+		steps   []step
+	}{
+		{
+			name:    "gcra burst and refill",
+			limiter: func() Limiter { return NewGCRA(3, 1) },
+			steps: []step{
+				{at: 0, n: 1, allowed: true, remaining: 2},
+				{at: 0, n: 1, allowed: true, remaining: 1},
+				{at: 0, n: 1, allowed: true, remaining: 0},
+				{at: 0, n: 1, allowed: false, remaining: 0, retryAfter: time.Second},
+				{at: 500 * time.Millisecond, n: 1, allowed: false, remaining: 0, retryAfter: 500 * time.Millisecond},
+				{at: time.Second, n: 1, allowed: true, remaining: 0},
+				{at: 10 * time.Second, n: 1, allowed: true, remaining: 2},
+			},
+		},
+		{
+			name:    "gcra cost",
+			limiter: func() Limiter { return NewGCRA(5, 2) },
+			steps: []step{
+				{at: 0, n: 4, allowed: true, remaining: 1},
+				{at: 0, n: 2, allowed: false, remaining: 1, retryAfter: 500 * time.Millisecond},
+				{at: 500 * time.Millisecond, n: 2, allowed: true, remaining: 0},
+				// a cost above the capacity is charged as the capacity
+				{at: 10 * time.Second, n: 50, allowed: true, remaining: 0},
+			},
+		},
+		{
+			name:    "sliding window log",
+			limiter: func() Limiter { return NewSlidingWindowLog(3, 10*time.Second) },
+			steps: []step{
+				{at: 0, n: 1, allowed: true, remaining: 2},
+				{at: time.Second, n: 1, allowed: true, remaining: 1},
+				{at: 2 * time.Second, n: 1, allowed: true, remaining: 0},
+				// the first request leaves the window at 10s
+				{at: 3 * time.Second, n: 1, allowed: false, remaining: 0, retryAfter: 7 * time.Second},
+				{at: 10 * time.Second, n: 1, allowed: true, remaining: 0},
+				// two have to leave: the one from 2s does at 12s
+				{at: 10 * time.Second, n: 2, allowed: false, remaining: 0, retryAfter: 2 * time.Second},
+				{at: 12 * time.Second, n: 2, allowed: true, remaining: 0},
+			},
+		},
+		{
+			name:    "sliding window counter",
+			limiter: func() Limiter { return NewSlidingWindowCounter(10, 10*time.Second) },
+			steps: []step{
+				{at: 0, n: 10, allowed: true, remaining: 0},
+				// only once the full window is previous and a tenth of it
+				// has slid out
+				{at: 5 * time.Second, n: 1, allowed: false, remaining: 0, retryAfter: 6 * time.Second},
+				// 10*0.9 + 1
+				{at: 11 * time.Second, n: 1, allowed: true, remaining: 0},
+				{at: 11 * time.Second, n: 1, allowed: false, remaining: 0, retryAfter: time.Second},
+				{at: 12 * time.Second, n: 1, allowed: true, remaining: 0},
+				// both windows have passed
+				{at: 35 * time.Second, n: 4, allowed: true, remaining: 6},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runSteps(t, tt.limiter(), tt.steps)
+		})
+	}
+}
+
+func TestNewLimiterWindow(t *testing.T) {
+	now := time.Unix(1_200_000, 0)
+	for _, algorithm := range []string{AlgorithmSlidingWindowLog, AlgorithmSlidingWindowCounter} {
+		t.Run(algorithm, func(t *testing.T) {
+			// 60 per minute, however fast the bucket would refill
+			l, err := newLimiter(algorithm, 60, 1000, time.Minute, now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if d := l.Allow(now, 60); !d.Allowed {
+				t.Fatal("first 60 requests denied")
+			}
+			if d := l.Allow(now.Add(30*time.Second), 1); d.Allowed {
+				t.Fatal("request within the window allowed")
+			}
+		})
+	}
+}
+
+func TestResolveLimitsWindow(t *testing.T) {
+	plan := models.Plan{Capacity: 10, RatePerSec: 1, WindowSec: 10}
+	if got := ResolveLimits(models.User{}, plan).Window; got != 10*time.Second {
+		t.Fatalf("plan window = %v, want 10s", got)
+	}
+	window := 60
+	if got := ResolveLimits(models.User{WindowSec: &window}, plan).Window; got != time.Minute {
+		t.Fatalf("overridden window = %v, want 1m", got)
+	}
+}
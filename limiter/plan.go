@@ -0,0 +1,108 @@
+package limiter
+
+import (
+	"fmt"
+	"time"
+
+	"http-load-balancer/models"
+	"http-load-balancer/repository"
+)
+
+// DefaultPlan is the plan of clients that don't reference one. It is
+// seeded from the user section of the config on startup.
+const DefaultPlan = "default"
+
+// Limits are the settings a client is actually limited by: its plan with
+// the client's own overrides applied on top.
+type Limits struct {
+	PlanID     uint64
+	PlanName   string
+	Capacity   int
+	RatePerSec int
+	// Window is what the sliding window algorithms allow Capacity
+	// requests in.
+	Window        time.Duration
+	QuotaLimit    int64
+	QuotaPeriod   string
+	MaxConcurrent int
+	Priority      int
+	// Shadow means the rate limit and quota are only recorded, not enforced.
+	Shadow bool
+}
+
+// ResolveLimits applies user's overrides to plan.
+func ResolveLimits(user models.User, plan models.Plan) Limits {
+	l := Limits{
+		PlanID:        plan.ID,
+		PlanName:      plan.Name,
+		Capacity:      plan.Capacity,
+		RatePerSec:    plan.RatePerSec,
+		Window:        time.Duration(plan.WindowSec) * time.Second,
+		QuotaLimit:    plan.QuotaLimit,
+		QuotaPeriod:   plan.QuotaPeriod,
+		MaxConcurrent: plan.MaxConcurrent,
+		Priority:      plan.Priority,
+		Shadow:        user.Shadow,
+	}
+	if user.Capacity != nil {
+		l.Capacity = *user.Capacity
+	}
+	if user.RatePerSec != nil {
+		l.RatePerSec = *user.RatePerSec
+	}
+	if user.WindowSec != nil {
+		l.Window = time.Duration(*user.WindowSec) * time.Second
+	}
+	if user.QuotaLimit != nil {
+		l.QuotaLimit = *user.QuotaLimit
+	}
+	if user.QuotaPeriod != nil {
+		l.QuotaPeriod = *user.QuotaPeriod
+	}
+	if user.MaxConcurrent != nil {
+		l.MaxConcurrent = *user.MaxConcurrent
+	}
+	return l
+}
+
+// PlanResolver loads clients together with their effective limits. With
+// shadow set every client is in shadow mode.
+type PlanResolver struct {
+	userRepo repository.UserRepository
+	planRepo repository.PlanRepository
+	shadow   bool
+}
+
+func NewPlanResolver(
+	userRepo repository.UserRepository,
+	planRepo repository.PlanRepository,
+	shadow bool,
+) *PlanResolver {
+	return &PlanResolver{
+		userRepo: userRepo,
+		planRepo: planRepo,
+		shadow:   shadow,
+	}
+}
+
+func (r *PlanResolver) Resolve(userID uint64) (models.User, Limits, error) {
+	const op = "PlanResolver.Resolve"
+
+	user, err := r.userRepo.GetByID(userID)
+	if err != nil {
+		return models.User{}, Limits{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	var plan models.Plan
+	if user.PlanID != nil {
+		plan, err = r.planRepo.GetByID(*user.PlanID)
+	} else {
+		plan, err = r.planRepo.GetByName(DefaultPlan)
+	}
+	if err != nil {
+		return models.User{}, Limits{}, fmt.Errorf("%s: %w", op, err)
+	}
+	limits := ResolveLimits(user, plan)
+	limits.Shadow = limits.Shadow || r.shadow
+	return user, limits, nil
+}
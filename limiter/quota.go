@@ -0,0 +1,399 @@
+package limiter
+
+import (
+	"fmt"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+
+	"http-load-balancer/lib/logger/sl"
+	"http-load-balancer/repository"
+)
+
+const (
+	QuotaPeriodHour  = "hour"
+	QuotaPeriodDay   = "day"
+	QuotaPeriodMonth = "month"
+)
+
+func ValidateQuotaPeriod(period string) error {
+	switch period {
+	case QuotaPeriodHour, QuotaPeriodDay, QuotaPeriodMonth:
+		return nil
+	default:
+		return fmt.Errorf("%w: %q", ErrUnknownQuotaPeriod, period)
+	}
+}
+
+// Usage is a client's consumption of its quota in the current window.
+type Usage struct {
+	Limit       int64
+	Used        int64
+	Period      string
+	WindowStart time.Time
+	WindowEnd   time.Time
+}
+
+type quotaEntry struct {
+	ready   chan struct{}
+	loadErr error
+
+	mu          sync.Mutex
+	shadow      bool
+	limit       int64
+	period      string
+	windowStart time.Time
+	used        int64
+	pending     int64 // part of used not flushed yet
+}
+
+// Quotas enforces long-horizon request caps per client over calendar
+// aligned windows (hour, day, month) in a fixed timezone. Counters live in
+// memory and are added to the client_usage table in batches; every request
+// is counted, the cap is only enforced when a client has a quota_limit.
+type Quotas struct {
+	plans         *PlanResolver
+	usageRepo     repository.UsageRepository
+	location      *time.Location
+	flushInterval time.Duration
+	log           *slog.Logger
+
+	entries sync.Map // client ID -> *quotaEntry
+
+	mu    sync.Mutex
+	carry []repository.UsageIncrement // pending counts not in an entry anymore
+
+	// flushMu keeps loads from reading a counter while counts for it are
+	// being written, when they are neither in the DB nor in carry.
+	flushMu sync.RWMutex
+
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+}
+
+func NewQuotas(
+	plans *PlanResolver,
+	usageRepo repository.UsageRepository,
+	location *time.Location,
+	flushInterval time.Duration,
+	log *slog.Logger,
+) *Quotas {
+	return &Quotas{
+		plans:         plans,
+		usageRepo:     usageRepo,
+		location:      location,
+		flushInterval: flushInterval,
+		log:           log,
+		stopChan:      make(chan struct{}),
+	}
+}
+
+func (q *Quotas) Start() {
+	q.wg.Add(1)
+	go q.run()
+}
+
+// Stop halts the background flusher after one final flush.
+func (q *Quotas) Stop() {
+	close(q.stopChan)
+	q.wg.Wait()
+}
+
+// Allow counts a request against the client's quota. Rejected requests are
+// not counted.
+func (q *Quotas) Allow(userID uint64) (Decision, error) {
+	const op = "Quotas.Allow"
+
+	e, err := q.entry(userID)
+	if err != nil {
+		return Decision{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	now := time.Now()
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	q.roll(userID, e, now)
+	windowEnd := windowEnd(e.period, e.windowStart)
+	allowed := e.limit <= 0 || e.used < e.limit
+	if allowed {
+		e.used++
+		e.pending++
+	}
+
+	d := Decision{
+		Allowed:   allowed,
+		Limit:     int(e.limit),
+		Remaining: int(max(e.limit-e.used, 0)),
+		Reset:     windowEnd.Sub(now),
+		Shadow:    e.shadow,
+	}
+	if !allowed {
+		d.RetryAfter = d.Reset
+	}
+	return d, nil
+}
+
+func (q *Quotas) Usage(userID uint64) (Usage, error) {
+	const op = "Quotas.Usage"
+
+	e, err := q.entry(userID)
+	if err != nil {
+		return Usage{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	q.roll(userID, e, time.Now())
+	return Usage{
+		Limit:       e.limit,
+		Used:        e.used,
+		Period:      e.period,
+		WindowStart: e.windowStart,
+		WindowEnd:   windowEnd(e.period, e.windowStart),
+	}, nil
+}
+
+// Forget drops a client's cached quota settings after they were changed.
+// Unflushed usage is kept.
+func (q *Quotas) Forget(userID uint64) {
+	v, ok := q.entries.LoadAndDelete(userID)
+	if !ok {
+		return
+	}
+	e := v.(*quotaEntry)
+	<-e.ready
+	if e.loadErr != nil {
+		return
+	}
+
+	e.mu.Lock()
+	q.carryPending(userID, e)
+	e.mu.Unlock()
+}
+
+// Remove drops everything kept for a deleted client, including usage not
+// flushed yet: the client's counters went with it.
+func (q *Quotas) Remove(userID uint64) {
+	q.mu.Lock()
+	q.carry = slices.DeleteFunc(q.carry, func(inc repository.UsageIncrement) bool {
+		return inc.ClientID == userID
+	})
+	q.mu.Unlock()
+
+	v, ok := q.entries.LoadAndDelete(userID)
+	if !ok {
+		return
+	}
+	e := v.(*quotaEntry)
+	<-e.ready
+	e.mu.Lock()
+	e.pending = 0
+	e.mu.Unlock()
+}
+
+// ForgetAll drops the cached quota settings of every client, e.g. after a
+// plan they may be on was changed.
+func (q *Quotas) ForgetAll() {
+	q.entries.Range(func(key, _ any) bool {
+		q.Forget(key.(uint64))
+		return true
+	})
+}
+
+func (q *Quotas) entry(userID uint64) (*quotaEntry, error) {
+	v, loaded := q.entries.LoadOrStore(userID, &quotaEntry{ready: make(chan struct{})})
+	e := v.(*quotaEntry)
+	if !loaded {
+		q.load(userID, e)
+	}
+
+	<-e.ready
+	if e.loadErr != nil {
+		return nil, e.loadErr
+	}
+	return e, nil
+}
+
+func (q *Quotas) load(userID uint64, e *quotaEntry) {
+	defer close(e.ready)
+
+	_, limits, err := q.plans.Resolve(userID)
+	if err != nil {
+		e.loadErr = err
+		q.entries.Delete(userID)
+		return
+	}
+
+	e.shadow = limits.Shadow
+	e.limit = limits.QuotaLimit
+	e.period = limits.QuotaPeriod
+	if ValidateQuotaPeriod(e.period) != nil {
+		e.period = QuotaPeriodMonth
+	}
+	e.windowStart = windowStart(e.period, time.Now().In(q.location))
+
+	q.flushMu.RLock()
+	defer q.flushMu.RUnlock()
+	e.used, err = q.usageRepo.Get(userID, e.period, e.windowStart)
+	if err != nil {
+		e.loadErr = err
+		q.entries.Delete(userID)
+		return
+	}
+	// counts of a forgotten entry that haven't been written yet
+	e.used += q.carried(userID, e.period, e.windowStart)
+}
+
+func (q *Quotas) carried(userID uint64, period string, windowStart time.Time) int64 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var n int64
+	for _, inc := range q.carry {
+		if inc.ClientID == userID && inc.Period == period && inc.WindowStart.Equal(windowStart) {
+			n += inc.Requests
+		}
+	}
+	return n
+}
+
+// roll moves e into the window containing now. Counts of the window that
+// ended are handed to the flusher.
+func (q *Quotas) roll(userID uint64, e *quotaEntry, now time.Time) {
+	if now.Before(windowEnd(e.period, e.windowStart)) {
+		return
+	}
+	q.carryPending(userID, e)
+	e.windowStart = windowStart(e.period, now.In(q.location))
+	e.used = 0
+}
+
+func (q *Quotas) carryPending(userID uint64, e *quotaEntry) {
+	if e.pending == 0 {
+		return
+	}
+	q.mu.Lock()
+	q.carry = append(q.carry, repository.UsageIncrement{
+		ClientID:    userID,
+		Period:      e.period,
+		WindowStart: e.windowStart,
+		Requests:    e.pending,
+	})
+	q.mu.Unlock()
+	e.pending = 0
+}
+
+func (q *Quotas) run() {
+	defer q.wg.Done()
+
+	ticker := time.NewTicker(q.flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			q.flush()
+		case <-q.stopChan:
+			q.flush()
+			return
+		}
+	}
+}
+
+func (q *Quotas) flush() {
+	q.flushMu.Lock()
+	defer q.flushMu.Unlock()
+
+	q.mu.Lock()
+	increments := q.carry
+	q.carry = nil
+	q.mu.Unlock()
+
+	q.entries.Range(func(key, value any) bool {
+		e := value.(*quotaEntry)
+		select {
+		case <-e.ready:
+		default:
+			return true
+		}
+		if e.loadErr != nil {
+			return true
+		}
+
+		e.mu.Lock()
+		if e.pending > 0 {
+			increments = append(increments, repository.UsageIncrement{
+				ClientID:    key.(uint64),
+				Period:      e.period,
+				WindowStart: e.windowStart,
+				Requests:    e.pending,
+			})
+			e.pending = 0
+		}
+		e.mu.Unlock()
+		return true
+	})
+
+	increments = mergeIncrements(increments)
+	dropped, err := q.usageRepo.AddBatch(increments)
+	if len(dropped) > 0 {
+		q.log.Warn("dropped quota usage of deleted clients", slog.Any("client_ids", dropped))
+	}
+	if err != nil {
+		q.log.Error("failed to flush quota usage", sl.Err(err), slog.Int("counters", len(increments)))
+		// retry with the next flush; counts may be lost if the process
+		// exits before that, never double counted
+		q.mu.Lock()
+		q.carry = append(q.carry, increments...)
+		q.mu.Unlock()
+	}
+}
+
+type usageKey struct {
+	clientID    uint64
+	period      string
+	windowStart int64
+}
+
+// mergeIncrements sums increments of the same counter, e.g. counts carried
+// from a forgotten entry and those of its reloaded successor: a single
+// INSERT ... ON CONFLICT can't update one row twice.
+func mergeIncrements(increments []repository.UsageIncrement) []repository.UsageIncrement {
+	merged := make([]repository.UsageIncrement, 0, len(increments))
+	index := make(map[usageKey]int, len(increments))
+	for _, inc := range increments {
+		key := usageKey{inc.ClientID, inc.Period, inc.WindowStart.UnixNano()}
+		if i, ok := index[key]; ok {
+			merged[i].Requests += inc.Requests
+			continue
+		}
+		index[key] = len(merged)
+		merged = append(merged, inc)
+	}
+	return merged
+}
+
+func windowStart(period string, t time.Time) time.Time {
+	switch period {
+	case QuotaPeriodHour:
+		return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, t.Location())
+	case QuotaPeriodDay:
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	default:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location())
+	}
+}
+
+func windowEnd(period string, start time.Time) time.Time {
+	switch period {
+	case QuotaPeriodHour:
+		return start.Add(time.Hour)
+	case QuotaPeriodDay:
+		return start.AddDate(0, 0, 1)
+	default:
+		return start.AddDate(0, 1, 0)
+	}
+}
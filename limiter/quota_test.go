@@ -0,0 +1,174 @@
+package limiter
+
+import (
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"http-load-balancer/models"
+	"http-load-balancer/repository"
+)
+
+func TestWindowStartEnd(t *testing.T) {
+	moscow := time.FixedZone("MSK", 3*60*60)
+	tests := []struct {
+		name   string
+		period string
+		t      time.Time
+		start  time.Time
+		end    time.Time
+	}{
+		{
+			name:   "hour",
+			period: QuotaPeriodHour,
+			t:      time.Date(2026, 3, 14, 15, 9, 26, 0, time.UTC),
+			start:  time.Date(2026, 3, 14, 15, 0, 0, 0, time.UTC),
+			end:    time.Date(2026, 3, 14, 16, 0, 0, 0, time.UTC),
+		},
+		{
+			name:   "day in a timezone",
+			period: QuotaPeriodDay,
+			t:      time.Date(2026, 3, 14, 1, 30, 0, 0, moscow),
+			start:  time.Date(2026, 3, 14, 0, 0, 0, 0, moscow),
+			end:    time.Date(2026, 3, 15, 0, 0, 0, 0, moscow),
+		},
+		{
+			name:   "month",
+			period: QuotaPeriodMonth,
+			t:      time.Date(2026, 1, 31, 23, 59, 59, 0, time.UTC),
+			start:  time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC),
+			end:    time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:   "december rolls over the year",
+			period: QuotaPeriodMonth,
+			t:      time.Date(2026, 12, 5, 0, 0, 0, 0, time.UTC),
+			start:  time.Date(2026, 12, 1, 0, 0, 0, 0, time.UTC),
+			end:    time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start := windowStart(tt.period, tt.t)
+			if !start.Equal(tt.start) {
+				t.Errorf("windowStart = %v, want %v", start, tt.start)
+			}
+			if end := windowEnd(tt.period, start); !end.Equal(tt.end) {
+				t.Errorf("windowEnd = %v, want %v", end, tt.end)
+			}
+		})
+	}
+}
+
+func TestMergeIncrements(t *testing.T) {
+	w1 := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	w2 := time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC)
+
+	got := mergeIncrements([]repository.UsageIncrement{
+		{ClientID: 1, Period: QuotaPeriodMonth, WindowStart: w1, Requests: 3},
+		{ClientID: 2, Period: QuotaPeriodMonth, WindowStart: w1, Requests: 5},
+		{ClientID: 1, Period: QuotaPeriodMonth, WindowStart: w1.In(time.FixedZone("X", 3600)), Requests: 4},
+		{ClientID: 1, Period: QuotaPeriodMonth, WindowStart: w2, Requests: 1},
+		{ClientID: 1, Period: QuotaPeriodDay, WindowStart: w1, Requests: 2},
+	})
+	want := []int64{7, 5, 1, 2}
+	if len(got) != len(want) {
+		t.Fatalf("got %d increments, want %d: %+v", len(got), len(want), got)
+	}
+	for i, inc := range got {
+		if inc.Requests != want[i] {
+			t.Errorf("increment %d has %d requests, want %d", i, inc.Requests, want[i])
+		}
+	}
+}
+
+func newTestQuotas(limit int64) (*Quotas, *fakeUsage) {
+	users := newFakeUsers(models.User{ID: 1})
+	plans := newFakePlans(models.Plan{
+		ID:          1,
+		Name:        DefaultPlan,
+		Capacity:    10,
+		RatePerSec:  1,
+		QuotaLimit:  limit,
+		QuotaPeriod: QuotaPeriodMonth,
+	})
+	usage := newFakeUsage()
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	return NewQuotas(NewPlanResolver(users, plans, false), usage, time.UTC, time.Hour, log), usage
+}
+
+func TestQuotasForgetKeepsUsage(t *testing.T) {
+	q, usage := newTestQuotas(10)
+
+	allow := func(n int) {
+		t.Helper()
+		for range n {
+			d, err := q.Allow(1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !d.Allowed {
+				t.Fatal("request rejected below the quota")
+			}
+		}
+	}
+
+	allow(3)
+	q.Forget(1)
+	// the reloaded entry has to see the carried counts before they are flushed
+	u, err := q.Usage(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Used != 3 {
+		t.Fatalf("used after Forget = %d, want 3", u.Used)
+	}
+
+	// carried and live counts of the same counter go out in one batch
+	allow(2)
+	q.flush()
+	if len(q.carry) != 0 {
+		t.Fatalf("flush left %d increments in carry", len(q.carry))
+	}
+	stored, _ := usage.Get(1, QuotaPeriodMonth, u.WindowStart)
+	if stored != 5 {
+		t.Fatalf("stored usage = %d, want 5", stored)
+	}
+
+	q.Forget(1)
+	allow(5)
+	if d, _ := q.Allow(1); d.Allowed {
+		t.Fatal("request allowed over the quota")
+	}
+}
+
+func TestQuotasFlushAfterDelete(t *testing.T) {
+	tests := []struct {
+		name   string
+		forget func(q *Quotas)
+	}{
+		// settings were changed right before the client was deleted, so
+		// its counts sit in carry
+		{"forgotten", func(q *Quotas) { q.Forget(1) }},
+		{"removed", func(q *Quotas) { q.Remove(1) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, usage := newTestQuotas(0)
+			for range 3 {
+				if _, err := q.Allow(1); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			tt.forget(q)
+			usage.deleteClient(1)
+			q.flush()
+			if len(q.carry) != 0 {
+				t.Fatalf("flush left %d increments of a deleted client in carry", len(q.carry))
+			}
+		})
+	}
+}
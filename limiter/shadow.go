@@ -0,0 +1,162 @@
+package limiter
+
+import (
+	"cmp"
+	"slices"
+	"sync"
+	"time"
+)
+
+// shadowMinute holds one client's shadowed traffic within one minute.
+type shadowMinute struct {
+	requests int64
+	rejected int64
+	byReason map[string]int64
+
+	firstRejected time.Time
+	lastRejected  time.Time
+}
+
+type shadowClient struct {
+	minutes map[int64]*shadowMinute // unix minute -> counters
+}
+
+// ShadowSummary is what a client in shadow mode would have experienced
+// had its limits been enforced.
+type ShadowSummary struct {
+	ClientID      uint64           `json:"client_id"`
+	Requests      int64            `json:"requests"`
+	Rejected      int64            `json:"rejected"`
+	RejectedRatio float64          `json:"rejected_ratio"`
+	ByReason      map[string]int64 `json:"by_reason"`
+	FirstRejected time.Time        `json:"first_rejected"`
+	LastRejected  time.Time        `json:"last_rejected"`
+}
+
+// ShadowRecorder counts requests of clients in shadow mode and how many of
+// them the limiters would have rejected, per minute, for retention.
+// Clients with nothing left within retention are dropped once a minute.
+type ShadowRecorder struct {
+	retention time.Duration
+
+	mu        sync.Mutex
+	clients   map[uint64]*shadowClient
+	nextSweep time.Time
+}
+
+func NewShadowRecorder(retention time.Duration) *ShadowRecorder {
+	return &ShadowRecorder{
+		retention: retention,
+		clients:   make(map[uint64]*shadowClient),
+	}
+}
+
+func (r *ShadowRecorder) Retention() time.Duration {
+	return r.retention
+}
+
+// Record counts one request of a shadowed client together with the codes
+// of the checks it failed; none means it would have been let through.
+func (r *ShadowRecorder) Record(clientID uint64, reasons ...string) {
+	now := time.Now()
+	minute := now.Unix() / 60
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if now.After(r.nextSweep) {
+		r.sweep(now)
+	}
+	c, ok := r.clients[clientID]
+	if !ok {
+		c = &shadowClient{minutes: make(map[int64]*shadowMinute)}
+		r.clients[clientID] = c
+	}
+	m, ok := c.minutes[minute]
+	if !ok {
+		r.prune(c, now)
+		m = &shadowMinute{byReason: make(map[string]int64)}
+		c.minutes[minute] = m
+	}
+
+	m.requests++
+	if len(reasons) == 0 {
+		return
+	}
+	m.rejected++
+	for _, reason := range reasons {
+		m.byReason[reason]++
+	}
+	if m.firstRejected.IsZero() {
+		m.firstRejected = now
+	}
+	m.lastRejected = now
+}
+
+// Report summarizes the clients that would have been rejected at least
+// once within the last window, most rejected first.
+func (r *ShadowRecorder) Report(window time.Duration) []ShadowSummary {
+	now := time.Now()
+	since := now.Add(-window).Unix() / 60
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.sweep(now)
+	report := make([]ShadowSummary, 0)
+	for id, c := range r.clients {
+		s := ShadowSummary{ClientID: id, ByReason: make(map[string]int64)}
+		for minute, m := range c.minutes {
+			if minute < since {
+				continue
+			}
+			s.Requests += m.requests
+			s.Rejected += m.rejected
+			for reason, n := range m.byReason {
+				s.ByReason[reason] += n
+			}
+			if m.rejected == 0 {
+				continue
+			}
+			if s.FirstRejected.IsZero() || m.firstRejected.Before(s.FirstRejected) {
+				s.FirstRejected = m.firstRejected
+			}
+			if m.lastRejected.After(s.LastRejected) {
+				s.LastRejected = m.lastRejected
+			}
+		}
+		if s.Rejected == 0 {
+			continue
+		}
+		s.RejectedRatio = float64(s.Rejected) / float64(s.Requests)
+		report = append(report, s)
+	}
+
+	slices.SortFunc(report, func(a, b ShadowSummary) int {
+		if c := cmp.Compare(b.Rejected, a.Rejected); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.ClientID, b.ClientID)
+	})
+	return report
+}
+
+// sweep prunes every client and drops those with nothing left.
+func (r *ShadowRecorder) sweep(now time.Time) {
+	for id, c := range r.clients {
+		r.prune(c, now)
+		if len(c.minutes) == 0 {
+			delete(r.clients, id)
+		}
+	}
+	r.nextSweep = now.Add(time.Minute)
+}
+
+func (r *ShadowRecorder) prune(c *shadowClient, now time.Time) {
+	oldest := now.Add(-r.retention).Unix() / 60
+	for minute := range c.minutes {
+		if minute < oldest {
+			delete(c.minutes, minute)
+		}
+	}
+}
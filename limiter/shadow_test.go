@@ -0,0 +1,48 @@
+package limiter
+
+import (
+	"testing"
+	"time"
+)
+
+func TestShadowReport(t *testing.T) {
+	r := NewShadowRecorder(time.Hour)
+	r.Record(1)
+	r.Record(1, "rate_limit_exceeded")
+	r.Record(1, "rate_limit_exceeded", "quota_exceeded")
+	r.Record(2, "quota_exceeded")
+	r.Record(3)
+
+	report := r.Report(time.Hour)
+	if len(report) != 2 {
+		t.Fatalf("report has %d clients, want 2", len(report))
+	}
+	first := report[0]
+	if first.ClientID != 1 || first.Requests != 3 || first.Rejected != 2 {
+		t.Fatalf("first = %+v, want client 1 with 2 of 3 rejected", first)
+	}
+	if first.ByReason["rate_limit_exceeded"] != 2 || first.ByReason["quota_exceeded"] != 1 {
+		t.Fatalf("by reason = %v", first.ByReason)
+	}
+	if report[1].ClientID != 2 || report[1].RejectedRatio != 1 {
+		t.Fatalf("second = %+v, want client 2 with everything rejected", report[1])
+	}
+}
+
+func TestShadowRecordPrunesIdleClients(t *testing.T) {
+	r := NewShadowRecorder(time.Hour)
+	r.Record(1, "rate_limit_exceeded")
+
+	// client 1 was last seen two hours ago
+	old := time.Now().Add(-2*time.Hour).Unix() / 60
+	r.clients[1].minutes = map[int64]*shadowMinute{old: {requests: 1, rejected: 1}}
+	r.nextSweep = time.Time{}
+
+	r.Record(2)
+	if _, ok := r.clients[1]; ok {
+		t.Fatal("idle client was not dropped")
+	}
+	if _, ok := r.clients[2]; !ok {
+		t.Fatal("recorded client is missing")
+	}
+}
@@ -0,0 +1,79 @@
+package limiter
+
+import "time"
+
+// SlidingWindowCounter approximates a sliding window from two fixed window
+// counters, weighting the previous window by how much of it still overlaps
+// the sliding one. It needs constant memory per client.
+type SlidingWindowCounter struct {
+	limit       float64
+	window      time.Duration
+	windowStart time.Time
+	current     float64
+	previous    float64
+}
+
+func NewSlidingWindowCounter(limit float64, window time.Duration) *SlidingWindowCounter {
+	return &SlidingWindowCounter{
+		limit:  limit,
+		window: window,
+	}
+}
+
+func (s *SlidingWindowCounter) Allow(now time.Time, n int) Decision {
+	cost := min(float64(n), s.limit)
+	s.advance(now)
+
+	elapsed := now.Sub(s.windowStart)
+	overlap := 1 - float64(elapsed)/float64(s.window)
+	count := s.previous*overlap + s.current
+
+	allowed := count+cost <= s.limit
+	if allowed {
+		s.current += cost
+		count += cost
+	}
+
+	d := Decision{
+		Allowed:   allowed,
+		Limit:     int(s.limit),
+		Remaining: max(int(s.limit-count), 0),
+		// by the end of the next window everything counted so far is gone
+		Reset: 2*s.window - elapsed,
+	}
+	if !allowed {
+		d.RetryAfter = s.retryAfter(elapsed, cost)
+	}
+	return d
+}
+
+// retryAfter is how long until the weighted count drops to limit-cost. If
+// the current window alone is over that, it can only happen once it has
+// become the previous one.
+func (s *SlidingWindowCounter) retryAfter(elapsed time.Duration, cost float64) time.Duration {
+	if s.current <= s.limit-cost && s.previous > 0 {
+		// previous*(1 - t/window) + current = limit - cost
+		t := time.Duration((1 - (s.limit-cost-s.current)/s.previous) * float64(s.window))
+		return max(t-elapsed, 0)
+	}
+	// in the next window: current*(1 - t/window) = limit - cost
+	t := time.Duration((1 - (s.limit-cost)/s.current) * float64(s.window))
+	return s.window - elapsed + max(t, 0)
+}
+
+func (s *SlidingWindowCounter) advance(now time.Time) {
+	if s.windowStart.IsZero() {
+		s.windowStart = now.Truncate(s.window)
+		return
+	}
+	switch passed := now.Sub(s.windowStart) / s.window; {
+	case passed == 1:
+		s.previous = s.current
+		s.current = 0
+		s.windowStart = s.windowStart.Add(s.window)
+	case passed > 1:
+		s.previous = 0
+		s.current = 0
+		s.windowStart = now.Truncate(s.window)
+	}
+}
@@ -0,0 +1,50 @@
+package limiter
+
+import "time"
+
+// SlidingWindowLog remembers the time of every allowed request within the
+// window, which makes it exact at the cost of O(limit) memory per client.
+type SlidingWindowLog struct {
+	limit  int
+	window time.Duration
+	log    []time.Time // oldest first
+}
+
+func NewSlidingWindowLog(limit float64, window time.Duration) *SlidingWindowLog {
+	return &SlidingWindowLog{
+		limit:  int(limit),
+		window: window,
+		log:    make([]time.Time, 0, int(limit)),
+	}
+}
+
+func (s *SlidingWindowLog) Allow(now time.Time, n int) Decision {
+	n = min(n, s.limit)
+	cutoff := now.Add(-s.window)
+	expired := 0
+	for expired < len(s.log) && !s.log[expired].After(cutoff) {
+		expired++
+	}
+	s.log = s.log[expired:]
+
+	allowed := len(s.log)+n <= s.limit
+	if allowed {
+		for range n {
+			s.log = append(s.log, now)
+		}
+	}
+
+	d := Decision{
+		Allowed:   allowed,
+		Limit:     s.limit,
+		Remaining: s.limit - len(s.log),
+	}
+	if len(s.log) > 0 {
+		d.Reset = s.log[len(s.log)-1].Add(s.window).Sub(now)
+	}
+	if !allowed {
+		// wait until enough of the oldest entries have expired
+		d.RetryAfter = s.log[len(s.log)+n-s.limit-1].Add(s.window).Sub(now)
+	}
+	return d
+}
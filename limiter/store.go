@@ -0,0 +1,368 @@
+package limiter
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"http-load-balancer/lib/logger/sl"
+	"http-load-balancer/models"
+	"http-load-balancer/repository"
+)
+
+const shardCount = 64
+
+// missTTL is how long a lookup of an unknown client is cached, so requests
+// with made-up client IDs don't each cost a DB query.
+const missTTL = 5 * time.Second
+
+// entry is the in-memory state of one client. ready is closed once the
+// client has been loaded from the DB; loadErr and expires are only valid
+// after that.
+type entry struct {
+	ready   chan struct{}
+	loadErr error
+	expires time.Time // of a cached miss
+
+	mu       sync.Mutex
+	limiter  Limiter
+	shadow   bool
+	priority int
+	dirty    bool
+}
+
+// bucketKey identifies one bucket of a client; the main bucket has an
+// empty name.
+type bucketKey struct {
+	userID uint64
+	bucket string
+}
+
+// Cost is what a request is charged: Tokens from the named bucket, or from
+// the client's main bucket when Bucket is empty.
+type Cost struct {
+	Bucket string
+	Tokens int
+	// Capacity and RatePerSec configure a named bucket; zero takes the
+	// client's own limits.
+	Capacity   int
+	RatePerSec int
+}
+
+type shard struct {
+	mu      sync.RWMutex
+	entries map[bucketKey]*entry
+}
+
+// Store keeps every client's limiters in memory, split over shards so that
+// unrelated clients never contend on the same lock. Clients are loaded
+// lazily on first use with the algorithm configured for them and the limits
+// of their plan. Besides its main bucket a client gets one bucket per named
+// route bucket it hits. Main token bucket state is flushed to the client
+// table in batches every flushInterval, so Allow never touches the DB for a
+// known client; everything else is kept in memory only.
+type Store struct {
+	repo          repository.UserRepository
+	plans         *PlanResolver
+	flushInterval time.Duration
+	shards        [shardCount]shard
+	log           *slog.Logger
+	stopChan      chan struct{}
+	wg            sync.WaitGroup
+}
+
+func NewStore(
+	repo repository.UserRepository,
+	plans *PlanResolver,
+	flushInterval time.Duration,
+	log *slog.Logger,
+) *Store {
+	st := &Store{
+		repo:          repo,
+		plans:         plans,
+		flushInterval: flushInterval,
+		log:           log,
+		stopChan:      make(chan struct{}),
+	}
+	for i := range st.shards {
+		st.shards[i].entries = make(map[bucketKey]*entry)
+	}
+	return st
+}
+
+func (st *Store) Start() {
+	st.wg.Add(1)
+	go st.run()
+}
+
+// Stop halts the background flusher after one final flush.
+func (st *Store) Stop() {
+	close(st.stopChan)
+	st.wg.Wait()
+}
+
+func (st *Store) Allow(userID uint64, cost Cost) (Decision, error) {
+	const op = "Store.Allow"
+
+	e, err := st.entry(bucketKey{userID, cost.Bucket}, cost)
+	if err != nil {
+		return Decision{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	d := e.limiter.Allow(time.Now(), max(cost.Tokens, 1))
+	d.Shadow = e.shadow
+	d.Priority = e.priority
+	if _, ok := e.limiter.(*TokenBucket); ok {
+		e.dirty = true
+	}
+	return d, nil
+}
+
+// Forget drops all cached buckets of a client, e.g. after its limits were
+// changed or it was deleted, so the next request reloads it from the DB.
+// Its token bucket is flushed first so that no state is lost.
+func (st *Store) Forget(userID uint64) {
+	s := st.shard(userID)
+	s.mu.Lock()
+	main := s.entries[bucketKey{userID: userID}]
+	for key := range s.entries {
+		if key.userID == userID {
+			delete(s.entries, key)
+		}
+	}
+	s.mu.Unlock()
+
+	if main == nil {
+		return
+	}
+	update, ok := main.flushUpdate(userID)
+	if !ok {
+		return
+	}
+	if err := st.repo.UpdateTokensBatch([]repository.TokensUpdate{update}); err != nil {
+		st.log.Error("failed to flush token bucket", sl.Err(err), slog.Uint64("client_id", userID))
+	}
+}
+
+func (st *Store) forgetBucket(key bucketKey) {
+	s := st.shard(key.userID)
+	s.mu.Lock()
+	delete(s.entries, key)
+	s.mu.Unlock()
+}
+
+// ForgetAll drops every client's cached state, e.g. after a plan they may
+// be on was changed. Token buckets are flushed first so that no state is
+// lost.
+func (st *Store) ForgetAll() {
+	st.flush()
+	for i := range st.shards {
+		s := &st.shards[i]
+		s.mu.Lock()
+		clear(s.entries)
+		s.mu.Unlock()
+	}
+}
+
+func (st *Store) entry(key bucketKey, cost Cost) (*entry, error) {
+	s := st.shard(key.userID)
+
+	s.mu.RLock()
+	e, ok := s.entries[key]
+	s.mu.RUnlock()
+
+	if !ok {
+		s.mu.Lock()
+		if e, ok = s.entries[key]; !ok {
+			e = &entry{ready: make(chan struct{})}
+			s.entries[key] = e
+		}
+		s.mu.Unlock()
+
+		// only the goroutine that created the entry loads it, everyone
+		// else waits on ready below
+		if !ok {
+			st.load(key, cost, e)
+		}
+	}
+
+	<-e.ready
+	if e.loadErr != nil {
+		if !ok || time.Now().Before(e.expires) {
+			return nil, e.loadErr
+		}
+		// the cached miss has expired, look the client up again
+		st.forgetMiss(key, e)
+		return st.entry(key, cost)
+	}
+	return e, nil
+}
+
+func (st *Store) load(key bucketKey, cost Cost, e *entry) {
+	defer close(e.ready)
+
+	user, limits, err := st.plans.Resolve(key.userID)
+	if err == nil {
+		e.shadow = limits.Shadow
+		e.priority = limits.Priority
+		if key.bucket == "" {
+			e.limiter, err = newClientLimiter(user, limits)
+		} else {
+			e.limiter, err = newBucketLimiter(user, limits, cost)
+		}
+	}
+	if err != nil {
+		e.loadErr = err
+		if errors.Is(err, repository.ErrUserNotFound) {
+			e.expires = time.Now().Add(missTTL)
+			return
+		}
+		// don't cache other failures, the DB may be back on the next try
+		st.forgetBucket(key)
+	}
+}
+
+// forgetMiss drops e if it is still the cached entry for key.
+func (st *Store) forgetMiss(key bucketKey, e *entry) {
+	s := st.shard(key.userID)
+	s.mu.Lock()
+	if s.entries[key] == e {
+		delete(s.entries, key)
+	}
+	s.mu.Unlock()
+}
+
+// pruneMisses drops expired misses that nobody asked about again.
+func (st *Store) pruneMisses() {
+	now := time.Now()
+	for i := range st.shards {
+		s := &st.shards[i]
+		s.mu.Lock()
+		for key, e := range s.entries {
+			select {
+			case <-e.ready:
+			default:
+				continue
+			}
+			if e.loadErr != nil && now.After(e.expires) {
+				delete(s.entries, key)
+			}
+		}
+		s.mu.Unlock()
+	}
+}
+
+func newClientLimiter(user models.User, limits Limits) (Limiter, error) {
+	capacity := float64(limits.Capacity)
+	rate := float64(limits.RatePerSec)
+
+	if user.Algorithm != AlgorithmTokenBucket && user.Algorithm != "" {
+		return newLimiter(user.Algorithm, capacity, rate, limits.Window, time.Now())
+	}
+
+	lastRefill, err := time.Parse(time.RFC3339, user.LastUpdated)
+	if err != nil {
+		lastRefill = time.Now()
+	}
+	return NewTokenBucket(capacity, rate, float64(user.Tokens), lastRefill), nil
+}
+
+// newBucketLimiter creates a named bucket. It always starts full, since
+// only the main bucket is persisted.
+func newBucketLimiter(user models.User, limits Limits, cost Cost) (Limiter, error) {
+	capacity := float64(limits.Capacity)
+	if cost.Capacity > 0 {
+		capacity = float64(cost.Capacity)
+	}
+	rate := float64(limits.RatePerSec)
+	if cost.RatePerSec > 0 {
+		rate = float64(cost.RatePerSec)
+	}
+	return newLimiter(user.Algorithm, capacity, rate, limits.Window, time.Now())
+}
+
+func (st *Store) shard(userID uint64) *shard {
+	return &st.shards[userID%shardCount]
+}
+
+func (st *Store) run() {
+	defer st.wg.Done()
+
+	ticker := time.NewTicker(st.flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			st.flush()
+			st.pruneMisses()
+		case <-st.stopChan:
+			st.flush()
+			return
+		}
+	}
+}
+
+// flush writes every token bucket that changed since the previous flush in
+// a single batch. On failure the entries are marked dirty again and retried
+// on the next tick.
+func (st *Store) flush() {
+	var updates []repository.TokensUpdate
+	var flushed []*entry
+	for i := range st.shards {
+		s := &st.shards[i]
+		s.mu.RLock()
+		for key, e := range s.entries {
+			if key.bucket != "" {
+				continue
+			}
+			if update, ok := e.flushUpdate(key.userID); ok {
+				updates = append(updates, update)
+				flushed = append(flushed, e)
+			}
+		}
+		s.mu.RUnlock()
+	}
+
+	if err := st.repo.UpdateTokensBatch(updates); err != nil {
+		st.log.Error("failed to flush token buckets", sl.Err(err), slog.Int("clients", len(updates)))
+		for _, e := range flushed {
+			e.mu.Lock()
+			e.dirty = true
+			e.mu.Unlock()
+		}
+	}
+}
+
+// flushUpdate returns the state of a loaded token bucket that changed since
+// it was last written and marks it clean.
+func (e *entry) flushUpdate(userID uint64) (repository.TokensUpdate, bool) {
+	select {
+	case <-e.ready:
+	default:
+		return repository.TokensUpdate{}, false
+	}
+	if e.loadErr != nil {
+		return repository.TokensUpdate{}, false
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	tb, ok := e.limiter.(*TokenBucket)
+	if !ok || !e.dirty {
+		return repository.TokensUpdate{}, false
+	}
+	e.dirty = false
+	tokens, lastRefill := tb.State()
+	return repository.TokensUpdate{
+		ID:          userID,
+		Tokens:      int(tokens),
+		LastUpdated: lastRefill,
+	}, true
+}
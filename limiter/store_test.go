@@ -0,0 +1,96 @@
+package limiter
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"http-load-balancer/models"
+	"http-load-balancer/repository"
+)
+
+func newTestStore(users *fakeUsers) *Store {
+	plans := newFakePlans(models.Plan{ID: 1, Name: DefaultPlan, Capacity: 10, RatePerSec: 1})
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	return NewStore(users, NewPlanResolver(users, plans, false), time.Hour, log)
+}
+
+func TestStoreForgetFlushes(t *testing.T) {
+	users := newFakeUsers(models.User{
+		ID:          1,
+		Algorithm:   AlgorithmTokenBucket,
+		Tokens:      10,
+		LastUpdated: time.Now().Format(time.RFC3339),
+	})
+	st := newTestStore(users)
+
+	for range 4 {
+		if _, err := st.Allow(1, Cost{Tokens: 1}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	st.Forget(1)
+
+	if len(users.flushed) != 1 {
+		t.Fatalf("flushed %d updates, want 1", len(users.flushed))
+	}
+	if got := users.users[1].Tokens; got != 6 {
+		t.Fatalf("stored tokens = %d, want 6", got)
+	}
+
+	// the reloaded bucket carries on where the forgotten one stopped
+	d, err := st.Allow(1, Cost{Tokens: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Remaining != 5 {
+		t.Fatalf("remaining = %d, want 5", d.Remaining)
+	}
+
+	// a clean bucket isn't written again
+	st.Forget(1)
+	st.Allow(1, Cost{})
+	st.flush()
+	st.Forget(1)
+	if len(users.flushed) != 3 {
+		t.Fatalf("flushed %d updates, want 3", len(users.flushed))
+	}
+}
+
+func TestStoreCachesMisses(t *testing.T) {
+	users := newFakeUsers()
+	st := newTestStore(users)
+
+	for range 3 {
+		_, err := st.Allow(7, Cost{})
+		if !errors.Is(err, repository.ErrUserNotFound) {
+			t.Fatalf("err = %v, want ErrUserNotFound", err)
+		}
+	}
+	if users.lookups != 1 {
+		t.Fatalf("%d lookups for an unknown client, want 1", users.lookups)
+	}
+
+	// an expired miss is looked up again and then pruned
+	key := bucketKey{userID: 7}
+	st.shard(7).entries[key].expires = time.Now().Add(-time.Second)
+	st.Allow(7, Cost{})
+	if users.lookups != 2 {
+		t.Fatalf("%d lookups after the miss expired, want 2", users.lookups)
+	}
+	st.shard(7).entries[key].expires = time.Now().Add(-time.Second)
+	st.pruneMisses()
+	if _, ok := st.shard(7).entries[key]; ok {
+		t.Fatal("expired miss was not pruned")
+	}
+
+	// a client created meanwhile is found once its miss is forgotten
+	st.Allow(7, Cost{})
+	users.users[7] = models.User{ID: 7}
+	st.Forget(7)
+	if _, err := st.Allow(7, Cost{}); err != nil {
+		t.Fatal(err)
+	}
+}
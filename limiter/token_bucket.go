@@ -1,64 +1,78 @@
 package limiter
 
-import (
-	"errors"
-	"fmt"
-	"sync"
-	"time"
-
-	"http-load-balancer/repository"
-)
+import "time"
 
 type TokenBucket struct {
-	repo        repository.UserRepository
-	defaultCap  int
-	defaultRate int
-	mu          sync.Mutex
+	capacity   float64
+	rate       float64
+	tokens     float64
+	lastRefill time.Time
 }
 
-func NewTokenBucket(repo repository.UserRepository, defaultCap, defaultRate int) *TokenBucket {
+func NewTokenBucket(capacity, rate, tokens float64, lastRefill time.Time) *TokenBucket {
 	return &TokenBucket{
-		repo:        repo,
-		defaultCap:  defaultCap,
-		defaultRate: defaultRate,
+		capacity:   capacity,
+		rate:       rate,
+		tokens:     min(tokens, capacity),
+		lastRefill: lastRefill,
 	}
 }
 
-func (tb *TokenBucket) Allow(userID uint64) (bool, error) {
-	const op = "TokenBucket.Allow"
-	tb.mu.Lock()
-	defer tb.mu.Unlock()
+func (tb *TokenBucket) Allow(now time.Time, n int) Decision {
+	return tb.AllowKeeping(now, n, 0)
+}
 
-	user, err := tb.repo.GetByID(userID)
-	if err != nil {
-		return false, fmt.Errorf("%s: %w", op, err)
+// AllowKeeping is Allow for a request that may only take its tokens if at
+// least keep are left in the bucket afterwards.
+func (tb *TokenBucket) AllowKeeping(now time.Time, n int, keep float64) Decision {
+	cost := min(float64(n), tb.capacity)
+	tb.refill(now)
+	allowed := tb.tokens-cost >= keep
+	if allowed {
+		tb.tokens -= cost
 	}
 
-	if errors.Is(err, repository.ErrUserNotFound) {
-		return false, fmt.Errorf("%s: %w", op, err)
+	d := Decision{
+		Allowed:   allowed,
+		Limit:     int(tb.capacity),
+		Remaining: max(int(tb.tokens-keep), 0),
+		Reset:     tb.timeToTokens(tb.capacity),
 	}
-
-	now := time.Now()
-	lastUpdated, _ := time.Parse(time.RFC3339, user.LastUpdated)
-	elapsed := now.Sub(lastUpdated).Seconds()
-	newTokens := int(elapsed * float64(user.RatePerSec))
-
-	if newTokens > 0 {
-		user.Tokens = min(user.Tokens+newTokens, user.Capacity)
-		user.LastUpdated = now.Format(time.RFC3339)
-		if _, err := tb.repo.UpdateTokens(user.ID, user.Tokens); err != nil {
-			return false, err
-		}
+	if !allowed {
+		d.RetryAfter = tb.timeToTokens(cost + keep)
 	}
+	return d
+}
 
-	if user.Tokens <= 0 {
-		return false, ErrRateLimitExceeded
+// Peek reports whether n tokens are available and, if not, how long until
+// they are, without taking any.
+func (tb *TokenBucket) Peek(now time.Time, n int) (bool, time.Duration) {
+	cost := min(float64(n), tb.capacity)
+	tb.refill(now)
+	if tb.tokens >= cost {
+		return true, 0
 	}
+	return false, tb.timeToTokens(cost)
+}
+
+// State returns what is persisted to the client table.
+func (tb *TokenBucket) State() (float64, time.Time) {
+	return tb.tokens, tb.lastRefill
+}
 
-	user.Tokens--
-	if _, err := tb.repo.UpdateTokens(user.ID, user.Tokens); err != nil {
-		return false, err
+func (tb *TokenBucket) refill(now time.Time) {
+	elapsed := now.Sub(tb.lastRefill).Seconds()
+	if elapsed <= 0 {
+		return
 	}
+	tb.tokens = min(tb.tokens+elapsed*tb.rate, tb.capacity)
+	tb.lastRefill = now
+}
 
-	return true, nil
+// timeToTokens is how long until the bucket holds n tokens.
+func (tb *TokenBucket) timeToTokens(n float64) time.Duration {
+	if tb.tokens >= n || tb.rate <= 0 {
+		return 0
+	}
+	return time.Duration((n - tb.tokens) / tb.rate * float64(time.Second))
 }
@@ -0,0 +1,58 @@
+package limiter
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTokenBucketDecision(t *testing.T) {
+	t0 := time.Unix(1_200_000, 0)
+	tests := []struct {
+		name       string
+		tokens     float64
+		at         time.Duration
+		n          int
+		allowed    bool
+		remaining  int
+		reset      time.Duration
+		retryAfter time.Duration
+	}{
+		{name: "full", tokens: 5, n: 1, allowed: true, remaining: 4, reset: time.Second},
+		{name: "drained", tokens: 5, n: 5, allowed: true, remaining: 0, reset: 5 * time.Second},
+		{name: "empty", tokens: 0, n: 1, allowed: false, remaining: 0, reset: 5 * time.Second, retryAfter: time.Second},
+		{name: "cost", tokens: 1, n: 3, allowed: false, remaining: 1, reset: 4 * time.Second, retryAfter: 2 * time.Second},
+		{name: "refilled", tokens: 0, at: 2500 * time.Millisecond, n: 2, allowed: true, remaining: 0, reset: 4500 * time.Millisecond},
+		{name: "capped refill", tokens: 0, at: time.Hour, n: 1, allowed: true, remaining: 4, reset: time.Second},
+		{name: "cost above capacity", tokens: 5, n: 50, allowed: true, remaining: 0, reset: 5 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tb := NewTokenBucket(5, 1, tt.tokens, t0)
+			d := tb.Allow(t0.Add(tt.at), tt.n)
+			if d.Allowed != tt.allowed || d.Remaining != tt.remaining || d.Limit != 5 {
+				t.Fatalf("got allowed %v, remaining %d, limit %d; want %v, %d, 5",
+					d.Allowed, d.Remaining, d.Limit, tt.allowed, tt.remaining)
+			}
+			if d.Reset != tt.reset || d.RetryAfter != tt.retryAfter {
+				t.Fatalf("got reset %v, retry after %v; want %v, %v", d.Reset, d.RetryAfter, tt.reset, tt.retryAfter)
+			}
+		})
+	}
+}
+
+func TestSeconds(t *testing.T) {
+	tests := []struct {
+		d    time.Duration
+		want int
+	}{
+		{0, 0},
+		{time.Nanosecond, 1},
+		{time.Second, 1},
+		{1500 * time.Millisecond, 2},
+	}
+	for _, tt := range tests {
+		if got := Seconds(tt.d); got != tt.want {
+			t.Errorf("Seconds(%v) = %d, want %d", tt.d, got, tt.want)
+		}
+	}
+}
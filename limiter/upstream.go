@@ -0,0 +1,117 @@
+package limiter
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"http-load-balancer/models"
+)
+
+type backendBucket struct {
+	maxRPS int
+	bucket *TokenBucket
+}
+
+// Upstream protects backends from the sum of all clients' traffic: a
+// global requests per second cap and an optional cap per backend
+// (Backend.MaxRPS). Backend buckets allow one second worth of burst and
+// are resized when a backend's MaxRPS changes.
+//
+// Part of the global burst is held back for clients of higher priority,
+// so that lower priorities are shed first as the global cap is reached:
+// a request of priority p may not leave fewer than
+// burst * priorityReserve / 2^p tokens.
+type Upstream struct {
+	mu       sync.Mutex
+	global   *TokenBucket // nil when unlimited
+	reserve  float64      // tokens held back from priority 0
+	backends map[uint64]*backendBucket
+}
+
+// NewUpstream creates the limiter. A zero globalRPS disables the global
+// cap; a zero burst defaults to globalRPS. priorityReserve is the share of
+// the burst held back from priority 0.
+func NewUpstream(globalRPS, burst int, priorityReserve float64) *Upstream {
+	u := &Upstream{backends: make(map[uint64]*backendBucket)}
+	if globalRPS > 0 {
+		if burst <= 0 {
+			burst = globalRPS
+		}
+		u.global = NewTokenBucket(float64(burst), float64(globalRPS), float64(burst), time.Now())
+		u.reserve = float64(burst) * min(max(priorityReserve, 0), 1)
+	}
+	return u
+}
+
+// AllowGlobal counts a request of a client with the given priority
+// against the global cap. Negative priorities count as 0.
+func (u *Upstream) AllowGlobal(priority int) Decision {
+	if u.global == nil {
+		return Decision{Allowed: true}
+	}
+
+	keep := math.Ldexp(u.reserve, -max(priority, 0))
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.global.AllowKeeping(time.Now(), 1, keep)
+}
+
+// Ready reports whether backend is below its MaxRPS, without counting a
+// request against it.
+func (u *Upstream) Ready(backend models.Backend) bool {
+	if backend.MaxRPS <= 0 {
+		return true
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	ready, _ := u.bucket(backend).Peek(time.Now(), 1)
+	return ready
+}
+
+// AllowBackend counts a request against backend's MaxRPS.
+func (u *Upstream) AllowBackend(backend models.Backend) bool {
+	if backend.MaxRPS <= 0 {
+		return true
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.bucket(backend).Allow(time.Now(), 1).Allowed
+}
+
+// RetryAfter is how long until the first of the saturated backends can take
+// a request again.
+func (u *Upstream) RetryAfter(backends []models.Backend) time.Duration {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	now := time.Now()
+	var wait time.Duration
+	found := false
+	for _, backend := range backends {
+		if backend.MaxRPS <= 0 {
+			continue
+		}
+		_, d := u.bucket(backend).Peek(now, 1)
+		if !found || d < wait {
+			wait = d
+			found = true
+		}
+	}
+	return wait
+}
+
+func (u *Upstream) bucket(backend models.Backend) *TokenBucket {
+	b, ok := u.backends[backend.ID]
+	if !ok || b.maxRPS != backend.MaxRPS {
+		rps := float64(backend.MaxRPS)
+		b = &backendBucket{
+			maxRPS: backend.MaxRPS,
+			bucket: NewTokenBucket(rps, rps, rps, time.Now()),
+		}
+		u.backends[backend.ID] = b
+	}
+	return b.bucket
+}
@@ -0,0 +1,54 @@
+package limiter
+
+import "testing"
+
+func TestUpstreamPriorityReserve(t *testing.T) {
+	tests := []struct {
+		name     string
+		reserve  float64
+		priority int
+		want     int
+	}{
+		{name: "no reserve", reserve: 0, priority: 0, want: 100},
+		{name: "priority 0", reserve: 0.2, priority: 0, want: 80},
+		{name: "negative priority", reserve: 0.2, priority: -3, want: 80},
+		{name: "priority 1", reserve: 0.2, priority: 1, want: 90},
+		{name: "priority 2", reserve: 0.2, priority: 2, want: 95},
+		{name: "whole burst reserved", reserve: 1, priority: 0, want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// refills one token every 1000s, so nothing comes back meanwhile
+			u := NewUpstream(1, 100, tt.reserve)
+			u.global = NewTokenBucket(100, 0.001, 100, u.global.lastRefill)
+
+			allowed := 0
+			for range 200 {
+				if u.AllowGlobal(tt.priority).Allowed {
+					allowed++
+				}
+			}
+			if allowed != tt.want {
+				t.Fatalf("allowed %d requests, want %d", allowed, tt.want)
+			}
+		})
+	}
+}
+
+func TestUpstreamShedsLowerPriorityFirst(t *testing.T) {
+	u := NewUpstream(1, 100, 0.2)
+	u.global = NewTokenBucket(100, 0.001, 100, u.global.lastRefill)
+
+	for range 80 {
+		if !u.AllowGlobal(0).Allowed {
+			t.Fatal("request within the unreserved burst denied")
+		}
+	}
+	d := u.AllowGlobal(0)
+	if d.Allowed || d.RetryAfter <= 0 {
+		t.Fatalf("priority 0 got %+v past its share", d)
+	}
+	if !u.AllowGlobal(1).Allowed {
+		t.Fatal("priority 1 denied while the reserve has room for it")
+	}
+}
@@ -2,11 +2,57 @@ package models
 
 import "time"
 
+// Administrative states of a backend, set through the admin API and
+// independent of the health-based IsAlive.
+const (
+	BackendEnabled = "enabled"
+	// BackendDraining receives no new requests but lets in-flight ones
+	// finish, so it can be removed without cutting anyone off.
+	BackendDraining = "draining"
+	BackendDisabled = "disabled"
+)
+
 type Backend struct {
 	ID          uint64    `db:"id"`
 	URL         string    `db:"url"`
 	IsAlive     bool      `db:"is_alive"`
+	State       string    `db:"state"        yaml:"state"`
+	Weight      int       `db:"weight"       yaml:"weight"`
+	MaxRPS      int       `db:"max_rps"      yaml:"max_rps"`
 	ActiveConns int       `db:"active_conns"`
 	CreatedAt   time.Time `db:"created_at"`
 	UpdatedAt   time.Time `db:"updated_at"`
+
+	// CircuitOpen and Saturated (at MaxRPS) are runtime-only state set by
+	// the balancer before asking a strategy for a backend.
+	CircuitOpen bool `db:"-" yaml:"-"`
+	Saturated   bool `db:"-" yaml:"-"`
+	// ReadySince is when the backend last became enabled and alive, kept
+	// by the registry; zero for backends that were ready at startup.
+	ReadySince time.Time `db:"-" yaml:"-"`
+	// Ramp is the share of its weight a backend in slow start gets, set by
+	// the balancer; zero means the backend is not in slow start.
+	Ramp float64 `db:"-" yaml:"-"`
+	// Tried marks backends the balancer already sent the current request
+	// to; they stay in the pool so strategies see a stable set.
+	Tried bool `db:"-" yaml:"-"`
+}
+
+// Ready reports whether b takes traffic as far as its own state goes.
+func (b Backend) Ready() bool {
+	return b.State == BackendEnabled && b.IsAlive
+}
+
+// EffectiveWeight is b's weight scaled down during slow start.
+func (b Backend) EffectiveWeight() float64 {
+	weight := float64(max(b.Weight, 1))
+	if b.Ramp > 0 && b.Ramp < 1 {
+		weight *= b.Ramp
+	}
+	return weight
+}
+
+// Routable reports whether strategies may send new requests to b.
+func (b Backend) Routable() bool {
+	return b.Ready() && !b.CircuitOpen && !b.Saturated && !b.Tried
 }
@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// HealthEvent is a backend being marked down or up by active health
+// checks, together with the check that decided it.
+type HealthEvent struct {
+	ID        uint64 `db:"id"         json:"event_id"`
+	BackendID uint64 `db:"backend_id" json:"backend_id"`
+	IsAlive   bool   `db:"is_alive"   json:"is_alive"`
+	// Reason is a short code: passed, timeout, connection_refused,
+	// status_503 and so on. Error is the full error of a failed check.
+	Reason    string    `db:"reason"     json:"reason"`
+	Error     string    `db:"error"      json:"error,omitempty"`
+	LatencyMS int64     `db:"latency_ms" json:"latency_ms"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+}
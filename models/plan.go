@@ -0,0 +1,14 @@
+package models
+
+// Plan is a named set of limits shared by many clients.
+type Plan struct {
+	ID            uint64 `db:"id"             json:"plan_id"`
+	Name          string `db:"name"           json:"name"`
+	Capacity      int    `db:"capacity"       json:"capacity"`
+	RatePerSec    int    `db:"rate_per_sec"   json:"rate_per_sec"`
+	WindowSec     int    `db:"window_sec"     json:"window_sec"`
+	QuotaLimit    int64  `db:"quota_limit"    json:"quota_limit"`
+	QuotaPeriod   string `db:"quota_period"   json:"quota_period"`
+	MaxConcurrent int    `db:"max_concurrent" json:"max_concurrent"`
+	Priority      int    `db:"priority"       json:"priority"`
+}
@@ -1,9 +1,19 @@
 package models
 
+// User is a client of the balancer. Limits left nil are inherited from
+// the client's plan, or from the default plan when PlanID is nil.
 type User struct {
-	ID          uint64 `db:"id"           json:"client_id"`
-	Capacity    int    `db:"capacity"     json:"capacity"`
-	RatePerSec  int    `db:"rate_per_sec" json:"rate_per_sec"`
-	Tokens      int    `db:"tokens"       json:"tokens"`
-	LastUpdated string `db:"last_updated" json:"last_updated"`
+	ID            uint64  `db:"id"             json:"client_id"`
+	APIKey        string  `db:"api_key"        json:"api_key"`
+	PlanID        *uint64 `db:"plan_id"        json:"plan_id"`
+	Algorithm     string  `db:"algorithm"      json:"algorithm"`
+	Shadow        bool    `db:"shadow"         json:"shadow"`
+	QuotaLimit    *int64  `db:"quota_limit"    json:"quota_limit"`
+	QuotaPeriod   *string `db:"quota_period"   json:"quota_period"`
+	MaxConcurrent *int    `db:"max_concurrent" json:"max_concurrent"`
+	Capacity      *int    `db:"capacity"       json:"capacity"`
+	RatePerSec    *int    `db:"rate_per_sec"   json:"rate_per_sec"`
+	WindowSec     *int    `db:"window_sec"     json:"window_sec"`
+	Tokens        int     `db:"tokens"         json:"tokens"`
+	LastUpdated   string  `db:"last_updated"   json:"last_updated"`
 }
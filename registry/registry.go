@@ -0,0 +1,261 @@
+package registry
+
+import (
+	"cmp"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+
+	"http-load-balancer/lib/logger/sl"
+	"http-load-balancer/models"
+	"http-load-balancer/repository"
+)
+
+// Registry is the in-memory set of backends that routing works from, so
+// that serving a request never waits on Postgres. Health changes are
+// applied in memory first and written to the DB in the background; admin
+// changes are written to the DB and then put here. Every syncInterval the
+// set is reloaded from the DB to pick up changes made by other instances.
+// While the DB is unreachable the last known set keeps being used.
+type Registry struct {
+	repo         repository.BackendRepository
+	syncInterval time.Duration
+	log          *slog.Logger
+
+	mu       sync.RWMutex
+	backends []models.Backend // sorted by ID
+	pending  map[uint64]bool  // is_alive changes not written to the DB yet
+
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+}
+
+func New(repo repository.BackendRepository, syncInterval time.Duration, log *slog.Logger) *Registry {
+	return &Registry{
+		repo:         repo,
+		syncInterval: syncInterval,
+		log:          log,
+		pending:      make(map[uint64]bool),
+		stopChan:     make(chan struct{}),
+	}
+}
+
+// Load fills the registry from the DB. It must succeed once before the
+// registry is used.
+func (r *Registry) Load() error {
+	const op = "Registry.Load"
+
+	backends, err := r.repo.GetAll()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	r.mu.Lock()
+	r.replace(backends)
+	r.mu.Unlock()
+	return nil
+}
+
+func (r *Registry) Start() {
+	r.wg.Add(1)
+	go r.run()
+}
+
+// Stop halts background syncing after writing out pending health changes.
+func (r *Registry) Stop() {
+	close(r.stopChan)
+	r.wg.Wait()
+}
+
+// All returns a copy of every known backend.
+func (r *Registry) All() []models.Backend {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return slices.Clone(r.backends)
+}
+
+// Active returns the backends that passed their last health check.
+func (r *Registry) Active() []models.Backend {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	active := make([]models.Backend, 0, len(r.backends))
+	for _, b := range r.backends {
+		if b.IsAlive {
+			active = append(active, b)
+		}
+	}
+	return active
+}
+
+func (r *Registry) Get(id uint64) (models.Backend, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	i, ok := r.index(id)
+	if !ok {
+		return models.Backend{}, false
+	}
+	return r.backends[i], true
+}
+
+// Put adds or replaces a backend after it was stored in the DB. Its health
+// is kept if the registry already knows better.
+func (r *Registry) Put(backend models.Backend) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if alive, ok := r.pending[backend.ID]; ok {
+		backend.IsAlive = alive
+	}
+	i, ok := r.index(backend.ID)
+	if ok {
+		backend.ReadySince = readySince(r.backends[i], backend)
+		r.backends[i] = backend
+		return
+	}
+	if backend.Ready() {
+		backend.ReadySince = time.Now()
+	}
+	r.backends = slices.Insert(r.backends, i, backend)
+}
+
+// Remove drops a backend after it was deleted from the DB.
+func (r *Registry) Remove(id uint64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.pending, id)
+	if i, ok := r.index(id); ok {
+		r.backends = slices.Delete(r.backends, i, i+1)
+	}
+}
+
+// SetIsAlive records the outcome of a health check. It takes effect for
+// routing immediately and is written to the DB on the next sync.
+func (r *Registry) SetIsAlive(id uint64, isAlive bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i, ok := r.index(id)
+	if !ok || r.backends[i].IsAlive == isAlive {
+		return
+	}
+	prev := r.backends[i]
+	r.backends[i].IsAlive = isAlive
+	r.backends[i].ReadySince = readySince(prev, r.backends[i])
+	r.pending[id] = isAlive
+}
+
+func (r *Registry) run() {
+	defer r.wg.Done()
+
+	ticker := time.NewTicker(r.syncInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			r.sync()
+		case <-r.stopChan:
+			r.flush()
+			return
+		}
+	}
+}
+
+// sync writes pending health changes and then reloads the set. The reload
+// is skipped while writes fail, so it can't undo changes the DB hasn't
+// seen yet.
+func (r *Registry) sync() {
+	if !r.flush() {
+		return
+	}
+
+	backends, err := r.repo.GetAll()
+	if err != nil {
+		r.log.Error("failed to reload backends, routing with the last known set", sl.Err(err))
+		return
+	}
+
+	r.mu.Lock()
+	r.replace(backends)
+	r.mu.Unlock()
+}
+
+// flush writes pending health changes, keeping the ones that failed for the
+// next attempt. It reports whether everything was written.
+func (r *Registry) flush() bool {
+	r.mu.Lock()
+	pending := r.pending
+	r.pending = make(map[uint64]bool)
+	r.mu.Unlock()
+
+	failed := make(map[uint64]bool)
+	for id, isAlive := range pending {
+		if _, err := r.repo.SetIsAlive(id, isAlive); err != nil {
+			r.log.Error("failed to store backend health",
+				sl.Err(err),
+				slog.Uint64("backend_id", id))
+			failed[id] = isAlive
+		}
+	}
+	if len(failed) == 0 {
+		return true
+	}
+
+	r.mu.Lock()
+	for id, isAlive := range failed {
+		// a newer result recorded meanwhile wins
+		if _, ok := r.pending[id]; !ok {
+			r.pending[id] = isAlive
+		}
+	}
+	r.mu.Unlock()
+	return false
+}
+
+// replace swaps in backends loaded from the DB, keeping health changes
+// that haven't been written yet. r.mu must be held.
+func (r *Registry) replace(backends []models.Backend) {
+	// backends present at the first load don't count as newly ready
+	initial := r.backends == nil
+	now := time.Now()
+
+	slices.SortFunc(backends, func(a, b models.Backend) int {
+		return cmp.Compare(a.ID, b.ID)
+	})
+	for i := range backends {
+		if alive, ok := r.pending[backends[i].ID]; ok {
+			backends[i].IsAlive = alive
+		}
+		if j, ok := r.index(backends[i].ID); ok {
+			backends[i].ReadySince = readySince(r.backends[j], backends[i])
+		} else if !initial && backends[i].Ready() {
+			backends[i].ReadySince = now
+		}
+	}
+	r.backends = backends
+}
+
+// readySince carries ReadySince over from prev to next, or restarts it if
+// the backend has just become ready.
+func readySince(prev, next models.Backend) time.Time {
+	switch {
+	case !next.Ready():
+		return time.Time{}
+	case !prev.Ready():
+		return time.Now()
+	default:
+		return prev.ReadySince
+	}
+}
+
+// index finds id in r.backends, or where it would be inserted.
+func (r *Registry) index(id uint64) (int, bool) {
+	return slices.BinarySearchFunc(r.backends, id, func(b models.Backend, id uint64) int {
+		return cmp.Compare(b.ID, id)
+	})
+}
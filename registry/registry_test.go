@@ -0,0 +1,171 @@
+package registry
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"http-load-balancer/lib/logger/slogdiscard"
+	"http-load-balancer/models"
+	"http-load-balancer/repository"
+)
+
+// fakeRepo is the backend table: GetAll returns its rows, SetIsAlive writes
+// to them unless failing is set.
+type fakeRepo struct {
+	repository.BackendRepository
+
+	mu       sync.Mutex
+	backends []models.Backend
+	failing  bool
+	writes   int
+}
+
+func (f *fakeRepo) GetAll() ([]models.Backend, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]models.Backend(nil), f.backends...), nil
+}
+
+func (f *fakeRepo) SetIsAlive(id uint64, isAlive bool) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.writes++
+	if f.failing {
+		return false, errors.New("connection refused")
+	}
+	for i := range f.backends {
+		if f.backends[i].ID == id {
+			f.backends[i].IsAlive = isAlive
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (f *fakeRepo) set(backends ...models.Backend) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.backends = backends
+}
+
+func backend(id uint64, alive bool) models.Backend {
+	return models.Backend{
+		ID:      id,
+		URL:     "backend:8080",
+		IsAlive: alive,
+		State:   models.BackendEnabled,
+	}
+}
+
+func newTestRegistry(t *testing.T, backends ...models.Backend) (*Registry, *fakeRepo) {
+	t.Helper()
+
+	repo := &fakeRepo{backends: backends}
+	r := New(repo, time.Minute, slogdiscard.NewDiscardLogger())
+	if err := r.Load(); err != nil {
+		t.Fatal(err)
+	}
+	return r, repo
+}
+
+func TestRegistryReplace(t *testing.T) {
+	r, repo := newTestRegistry(t, backend(2, true), backend(1, true))
+
+	all := r.All()
+	if len(all) != 2 || all[0].ID != 1 || all[1].ID != 2 {
+		t.Fatalf("All() = %v, want backends 1 and 2 sorted by ID", all)
+	}
+	for _, b := range all {
+		if !b.ReadySince.IsZero() {
+			t.Fatalf("backend %d present at the first load has ReadySince set", b.ID)
+		}
+	}
+
+	// another instance removed 1, added 3 and found 2 dead
+	repo.set(backend(2, false), backend(3, true))
+	r.sync()
+
+	if _, ok := r.Get(1); ok {
+		t.Fatal("removed backend still known")
+	}
+	if b, _ := r.Get(3); b.ReadySince.IsZero() {
+		t.Fatal("backend added after startup has no ReadySince")
+	}
+	active := r.Active()
+	if len(active) != 1 || active[0].ID != 3 {
+		t.Fatalf("Active() = %v, want only backend 3", active)
+	}
+}
+
+func TestRegistryPendingFlush(t *testing.T) {
+	r, repo := newTestRegistry(t, backend(1, true))
+	repo.failing = true
+
+	r.SetIsAlive(1, false)
+	r.sync()
+	if b, _ := r.Get(1); b.IsAlive {
+		t.Fatal("reload while writes fail undid the health change")
+	}
+	if len(r.pending) != 1 {
+		t.Fatalf("%d pending changes after a failed write, want 1", len(r.pending))
+	}
+
+	// a newer result recorded while the old one is pending wins
+	r.SetIsAlive(1, true)
+	r.SetIsAlive(1, false)
+	repo.failing = false
+	r.sync()
+	if len(r.pending) != 0 {
+		t.Fatalf("%d pending changes after a successful write, want 0", len(r.pending))
+	}
+	if stored, _ := repo.GetAll(); stored[0].IsAlive {
+		t.Fatal("health change not written")
+	}
+	if b, _ := r.Get(1); b.IsAlive {
+		t.Fatal("reload brought the backend back")
+	}
+}
+
+func TestRegistryReadySince(t *testing.T) {
+	r, repo := newTestRegistry(t, backend(1, true))
+
+	r.SetIsAlive(1, false)
+	if b, _ := r.Get(1); !b.ReadySince.IsZero() {
+		t.Fatal("dead backend has ReadySince set")
+	}
+	r.SetIsAlive(1, true)
+	b, _ := r.Get(1)
+	since := b.ReadySince
+	if since.IsZero() {
+		t.Fatal("recovered backend has no ReadySince")
+	}
+
+	// a reload or admin edit of a ready backend keeps its ramp going
+	r.sync()
+	if b, _ := r.Get(1); !b.ReadySince.Equal(since) {
+		t.Fatalf("ReadySince after reload = %v, want %v", b.ReadySince, since)
+	}
+	edited := backend(1, true)
+	edited.Weight = 5
+	r.Put(edited)
+	if b, _ := r.Get(1); !b.ReadySince.Equal(since) {
+		t.Fatalf("ReadySince after Put = %v, want %v", b.ReadySince, since)
+	}
+
+	// draining resets it, so enabling again restarts slow start
+	draining := backend(1, true)
+	draining.State = models.BackendDraining
+	repo.set(draining)
+	r.sync()
+	if b, _ := r.Get(1); !b.ReadySince.IsZero() {
+		t.Fatal("draining backend has ReadySince set")
+	}
+	repo.set(backend(1, true))
+	r.sync()
+	if b, _ := r.Get(1); !b.ReadySince.After(since) {
+		t.Fatal("re-enabled backend kept its old ReadySince")
+	}
+}
@@ -12,7 +12,10 @@ import (
 type BackendRepository interface {
 	GetAll() ([]models.Backend, error)
 	GetActive() ([]models.Backend, error)
+	GetByID(id uint64) (models.Backend, error)
 	Add(b *models.Backend) (*models.Backend, error)
+	Update(b *models.Backend) error
+	Delete(id uint64) error
 	SetIsAlive(id uint64, isAlive bool) (bool, error)
 }
 
@@ -50,6 +53,20 @@ func (r *backendRepository) GetActive() ([]models.Backend, error) {
 	return backends, nil
 }
 
+func (r *backendRepository) GetByID(id uint64) (models.Backend, error) {
+	const op = "BackendRepository.GetByID"
+
+	backend := models.Backend{}
+	err := r.db.Get(&backend, `SELECT * FROM backend WHERE id = $1`, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.Backend{}, fmt.Errorf("%s: %w", op, ErrBackendNotFound)
+		}
+		return models.Backend{}, fmt.Errorf("%s: %w", op, err)
+	}
+	return backend, nil
+}
+
 func (r *backendRepository) Add(b *models.Backend) (*models.Backend, error) {
 	const op = "BackendRepository.Add"
 
@@ -57,19 +74,66 @@ func (r *backendRepository) Add(b *models.Backend) (*models.Backend, error) {
 	err := r.db.Get(
 		&backendID,
 		`
-			INSERT INTO backend (url, is_alive, created_at, updated_at) 
-			VALUES($1, $2, $3, $4) 
+			INSERT INTO backend (url, is_alive, state, weight, max_rps, created_at, updated_at) 
+			VALUES($1, $2, $3, $4, $5, $6, $7) 
 			RETURNING id
 		`,
-		b.URL, b.IsAlive, b.CreatedAt, b.UpdatedAt,
+		b.URL, b.IsAlive, b.State, b.Weight, b.MaxRPS, b.CreatedAt, b.UpdatedAt,
 	)
 	if err != nil {
+		if isPQError(err, pqUniqueViolation) {
+			return nil, fmt.Errorf("%s: %w", op, ErrBackendExists)
+		}
 		return nil, fmt.Errorf("%s: %w", op, err)
 	}
 	b.ID = backendID
 	return b, nil
 }
 
+func (r *backendRepository) Update(b *models.Backend) error {
+	const op = "BackendRepository.Update"
+
+	res, err := r.db.Exec(
+		`
+			UPDATE backend
+			SET url = $1, state = $2, weight = $3, max_rps = $4, updated_at = CURRENT_TIMESTAMP
+			WHERE id = $5
+		`,
+		b.URL, b.State, b.Weight, b.MaxRPS, b.ID,
+	)
+	if err != nil {
+		if isPQError(err, pqUniqueViolation) {
+			return fmt.Errorf("%s: %w", op, ErrBackendExists)
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("%s: %w", op, ErrBackendNotFound)
+	}
+	return nil
+}
+
+func (r *backendRepository) Delete(id uint64) error {
+	const op = "BackendRepository.Delete"
+
+	res, err := r.db.Exec(`DELETE FROM backend WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("%s: %w", op, ErrBackendNotFound)
+	}
+	return nil
+}
+
 func (r *backendRepository) SetIsAlive(id uint64, isAlive bool) (bool, error) {
 	const op = "BackendRepository.SetActive"
 
@@ -5,5 +5,9 @@ import "errors"
 var (
 	ErrUserNotFound     = errors.New("user not found")
 	ErrBackendNotFound  = errors.New("backend not found")
+	ErrBackendExists    = errors.New("backend already exists")
 	ErrNoActiveBackends = errors.New("no active backends")
+	ErrPlanNotFound     = errors.New("plan not found")
+	ErrPlanExists       = errors.New("plan already exists")
+	ErrPlanInUse        = errors.New("plan is used by clients")
 )
@@ -0,0 +1,53 @@
+package repository
+
+import (
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+	"http-load-balancer/models"
+)
+
+type HealthEventRepository interface {
+	Add(e *models.HealthEvent) error
+	// GetByBackend returns up to limit of the backend's latest events,
+	// newest first.
+	GetByBackend(backendID uint64, limit int) ([]models.HealthEvent, error)
+}
+
+type healthEventRepository struct {
+	db *sqlx.DB
+}
+
+func NewHealthEventRepository(db *sqlx.DB) HealthEventRepository {
+	return &healthEventRepository{db: db}
+}
+
+func (r *healthEventRepository) Add(e *models.HealthEvent) error {
+	const op = "HealthEventRepository.Add"
+
+	err := r.db.Get(&e.ID, `
+		INSERT INTO backend_health_event (backend_id, is_alive, reason, error, latency_ms, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id
+	`, e.BackendID, e.IsAlive, e.Reason, e.Error, e.LatencyMS, e.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+func (r *healthEventRepository) GetByBackend(backendID uint64, limit int) ([]models.HealthEvent, error) {
+	const op = "HealthEventRepository.GetByBackend"
+
+	events := make([]models.HealthEvent, 0)
+	err := r.db.Select(&events, `
+		SELECT * FROM backend_health_event
+		WHERE backend_id = $1
+		ORDER BY created_at DESC, id DESC
+		LIMIT $2
+	`, backendID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return events, nil
+}
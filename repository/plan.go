@@ -0,0 +1,204 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"http-load-balancer/models"
+)
+
+const (
+	pqUniqueViolation     = "23505"
+	pqForeignKeyViolation = "23503"
+)
+
+type PlanRepository interface {
+	GetAll() ([]models.Plan, error)
+	GetByID(id uint64) (models.Plan, error)
+	GetByName(name string) (models.Plan, error)
+	Create(plan *models.Plan) (*models.Plan, error)
+	// CreateIfNotExists inserts plan unless a plan with the same name
+	// already exists, in which case the stored plan is left untouched.
+	CreateIfNotExists(plan *models.Plan) error
+	Update(plan *models.Plan) error
+	Delete(id uint64) error
+	// ClientIDs lists the clients assigned to the plan, plus those without
+	// a plan when withoutPlan is set.
+	ClientIDs(id uint64, withoutPlan bool) ([]uint64, error)
+}
+
+type planRepository struct {
+	db *sqlx.DB
+}
+
+func NewPlanRepository(db *sqlx.DB) PlanRepository {
+	return &planRepository{db: db}
+}
+
+func (r *planRepository) GetAll() ([]models.Plan, error) {
+	const op = "planRepository.GetAll"
+
+	plans := make([]models.Plan, 0)
+	err := r.db.Select(&plans, `SELECT * FROM plan ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return plans, nil
+}
+
+func (r *planRepository) GetByID(id uint64) (models.Plan, error) {
+	const op = "planRepository.GetByID"
+
+	plan := models.Plan{}
+	err := r.db.Get(&plan, `SELECT * FROM plan WHERE id = $1`, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.Plan{}, fmt.Errorf("%s: %w", op, ErrPlanNotFound)
+		}
+		return models.Plan{}, fmt.Errorf("%s: %w", op, err)
+	}
+	return plan, nil
+}
+
+func (r *planRepository) GetByName(name string) (models.Plan, error) {
+	const op = "planRepository.GetByName"
+
+	plan := models.Plan{}
+	err := r.db.Get(&plan, `SELECT * FROM plan WHERE name = $1`, name)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.Plan{}, fmt.Errorf("%s: %w", op, ErrPlanNotFound)
+		}
+		return models.Plan{}, fmt.Errorf("%s: %w", op, err)
+	}
+	return plan, nil
+}
+
+func (r *planRepository) Create(plan *models.Plan) (*models.Plan, error) {
+	const op = "planRepository.Create"
+
+	err := r.db.QueryRowx(
+		`
+			INSERT INTO plan (name, capacity, rate_per_sec, window_sec, quota_limit, quota_period, max_concurrent, priority)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+			RETURNING id
+		`,
+		plan.Name,
+		plan.Capacity,
+		plan.RatePerSec,
+		plan.WindowSec,
+		plan.QuotaLimit,
+		plan.QuotaPeriod,
+		plan.MaxConcurrent,
+		plan.Priority,
+	).Scan(&plan.ID)
+	if err != nil {
+		if isPQError(err, pqUniqueViolation) {
+			return nil, fmt.Errorf("%s: %w", op, ErrPlanExists)
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return plan, nil
+}
+
+func (r *planRepository) CreateIfNotExists(plan *models.Plan) error {
+	const op = "planRepository.CreateIfNotExists"
+
+	_, err := r.db.Exec(
+		`
+			INSERT INTO plan (name, capacity, rate_per_sec, window_sec, quota_limit, quota_period, max_concurrent, priority)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+			ON CONFLICT (name) DO NOTHING
+		`,
+		plan.Name,
+		plan.Capacity,
+		plan.RatePerSec,
+		plan.WindowSec,
+		plan.QuotaLimit,
+		plan.QuotaPeriod,
+		plan.MaxConcurrent,
+		plan.Priority,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
+func (r *planRepository) Update(plan *models.Plan) error {
+	const op = "planRepository.Update"
+
+	res, err := r.db.Exec(
+		`
+			UPDATE plan
+			SET name = $1, capacity = $2, rate_per_sec = $3, window_sec = $4, quota_limit = $5, quota_period = $6,
+				max_concurrent = $7, priority = $8
+			WHERE id = $9
+		`,
+		plan.Name,
+		plan.Capacity,
+		plan.RatePerSec,
+		plan.WindowSec,
+		plan.QuotaLimit,
+		plan.QuotaPeriod,
+		plan.MaxConcurrent,
+		plan.Priority,
+		plan.ID,
+	)
+	if err != nil {
+		if isPQError(err, pqUniqueViolation) {
+			return fmt.Errorf("%s: %w", op, ErrPlanExists)
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("%s: %w", op, ErrPlanNotFound)
+	}
+	return nil
+}
+
+func (r *planRepository) Delete(id uint64) error {
+	const op = "planRepository.Delete"
+
+	res, err := r.db.Exec(`DELETE FROM plan WHERE id = $1`, id)
+	if err != nil {
+		if isPQError(err, pqForeignKeyViolation) {
+			return fmt.Errorf("%s: %w", op, ErrPlanInUse)
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("%s: %w", op, ErrPlanNotFound)
+	}
+	return nil
+}
+
+func (r *planRepository) ClientIDs(id uint64, withoutPlan bool) ([]uint64, error) {
+	const op = "planRepository.ClientIDs"
+
+	var ids []uint64
+	err := r.db.Select(&ids, `
+		SELECT id FROM client
+		WHERE plan_id = $1 OR ($2 AND plan_id IS NULL)
+	`, id, withoutPlan)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return ids, nil
+}
+
+func isPQError(err error, code pq.ErrorCode) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == code
+}
@@ -0,0 +1,90 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+type UsageRepository interface {
+	Get(clientID uint64, period string, windowStart time.Time) (int64, error)
+	AddBatch(increments []UsageIncrement) (dropped []uint64, err error)
+}
+
+type UsageIncrement struct {
+	ClientID    uint64
+	Period      string
+	WindowStart time.Time
+	Requests    int64
+}
+
+type usageRepository struct {
+	db *sqlx.DB
+}
+
+func NewUsageRepository(db *sqlx.DB) UsageRepository {
+	return &usageRepository{db: db}
+}
+
+func (r *usageRepository) Get(clientID uint64, period string, windowStart time.Time) (int64, error) {
+	const op = "usageRepository.Get"
+
+	var requests int64
+	err := r.db.Get(&requests, `
+		SELECT requests FROM client_usage
+		WHERE client_id = $1 AND period = $2 AND window_start = $3
+	`, clientID, period, windowStart)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	return requests, nil
+}
+
+// AddBatch adds increments to the stored counters. Increments rather than
+// absolute values are written so that several balancer instances can
+// share the same counters. Increments of clients that no longer exist are
+// dropped instead of failing the batch; their IDs are returned.
+func (r *usageRepository) AddBatch(increments []UsageIncrement) ([]uint64, error) {
+	const op = "usageRepository.AddBatch"
+
+	if len(increments) == 0 {
+		return nil, nil
+	}
+	clientIDs := make([]int64, len(increments))
+	periods := make([]string, len(increments))
+	windowStarts := make([]string, len(increments))
+	requests := make([]int64, len(increments))
+	for i, inc := range increments {
+		clientIDs[i] = int64(inc.ClientID)
+		periods[i] = inc.Period
+		windowStarts[i] = inc.WindowStart.Format(time.RFC3339Nano)
+		requests[i] = inc.Requests
+	}
+
+	var dropped []uint64
+	err := r.db.Select(&dropped, `
+		WITH batch AS (
+			SELECT * FROM unnest($1::integer[], $2::varchar[], $3::timestamptz[], $4::bigint[])
+				AS b(client_id, period, window_start, requests)
+		), written AS (
+			INSERT INTO client_usage (client_id, period, window_start, requests)
+			SELECT b.client_id, b.period, b.window_start, b.requests
+			FROM batch b JOIN client c ON c.id = b.client_id
+			ON CONFLICT (client_id, period, window_start)
+			DO UPDATE SET requests = client_usage.requests + EXCLUDED.requests
+		)
+		SELECT DISTINCT b.client_id FROM batch b
+		WHERE NOT EXISTS (SELECT 1 FROM client c WHERE c.id = b.client_id)
+	`, pq.Array(clientIDs), pq.Array(periods), pq.Array(windowStarts), pq.Array(requests))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return dropped, nil
+}
@@ -4,22 +4,33 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 	"http-load-balancer/models"
 )
 
 type UserRepository interface {
 	GetAll() ([]models.User, error)
 	GetByID(id uint64) (models.User, error)
+	GetByAPIKey(apiKey string) (models.User, error)
 	Create(user *models.User) (*models.User, error)
+	RotateAPIKey(id uint64) (string, error)
 	Delete(id uint64) error
 	Update(user *models.User) error
 	UpdateTokens(id uint64, tokens int) (bool, error)
+	UpdateTokensBatch(updates []TokensUpdate) error
 	UpdateCapacity(id uint64, capacity int) (bool, error)
 	UpdateRatePerSec(id uint64, ratePerSecond int) (bool, error)
 }
 
+type TokensUpdate struct {
+	ID          uint64
+	Tokens      int
+	LastUpdated time.Time
+}
+
 type userRepository struct {
 	db *sqlx.DB
 }
@@ -32,7 +43,7 @@ func (r *userRepository) GetAll() ([]models.User, error) {
 	const op = "userRepository.GetAll"
 
 	users := make([]models.User, 0)
-	err := r.db.Select(&users, `SELECT * FROM user`)
+	err := r.db.Select(&users, `SELECT * FROM client`)
 	if err != nil {
 		return nil, fmt.Errorf("%s: %w", op, err)
 	}
@@ -43,7 +54,21 @@ func (r *userRepository) GetByID(id uint64) (models.User, error) {
 	const op = "userRepository.GetByID"
 
 	user := models.User{}
-	err := r.db.Get(&user, `SELECT * FROM user WHERE id = $1`, id)
+	err := r.db.Get(&user, `SELECT * FROM client WHERE id = $1`, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.User{}, fmt.Errorf("%s: %w", op, ErrUserNotFound)
+		}
+		return models.User{}, fmt.Errorf("%s: %w", op, err)
+	}
+	return user, nil
+}
+
+func (r *userRepository) GetByAPIKey(apiKey string) (models.User, error) {
+	const op = "userRepository.GetByAPIKey"
+
+	user := models.User{}
+	err := r.db.Get(&user, `SELECT * FROM client WHERE api_key = $1`, apiKey)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return models.User{}, fmt.Errorf("%s: %w", op, ErrUserNotFound)
@@ -56,26 +81,58 @@ func (r *userRepository) GetByID(id uint64) (models.User, error) {
 func (r *userRepository) Create(user *models.User) (*models.User, error) {
 	const op = "userRepository.Create"
 
-	var userID uint64
-	err := r.db.Get(&userID,
+	err := r.db.QueryRowx(
 		`
-			INSERT INTO user (capacity, rate_per_sec, tokens)
-			VALUES ($1, $2, $3)
-			RETURNING id
+			INSERT INTO client (
+				plan_id, capacity, rate_per_sec, window_sec, tokens, algorithm, quota_limit, quota_period,
+				max_concurrent, shadow
+			)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+			RETURNING id, api_key
 	`,
-		user.Capacity, user.RatePerSec, user.Tokens,
-	)
+		user.PlanID,
+		user.Capacity,
+		user.RatePerSec,
+		user.WindowSec,
+		user.Tokens,
+		user.Algorithm,
+		user.QuotaLimit,
+		user.QuotaPeriod,
+		user.MaxConcurrent,
+		user.Shadow,
+	).Scan(&user.ID, &user.APIKey)
 	if err != nil {
+		if isPQError(err, pqForeignKeyViolation) {
+			return nil, fmt.Errorf("%s: %w", op, ErrPlanNotFound)
+		}
 		return nil, fmt.Errorf("%s: %w", op, err)
 	}
-	user.ID = userID
 	return user, nil
 }
 
+// RotateAPIKey replaces a client's key with a new random one and returns it.
+func (r *userRepository) RotateAPIKey(id uint64) (string, error) {
+	const op = "userRepository.RotateAPIKey"
+
+	var apiKey string
+	err := r.db.QueryRowx(`
+		UPDATE client SET api_key = md5(random()::text || clock_timestamp()::text)
+		WHERE id = $1
+		RETURNING api_key
+	`, id).Scan(&apiKey)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", fmt.Errorf("%s: %w", op, ErrUserNotFound)
+		}
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+	return apiKey, nil
+}
+
 func (r *userRepository) Delete(id uint64) error {
 	const op = "userRepository.Delete"
 
-	res, err := r.db.Exec(`DELETE FROM user WHERE id = $1`, id)
+	res, err := r.db.Exec(`DELETE FROM client WHERE id = $1`, id)
 	if err != nil {
 		return fmt.Errorf("%s: %w", op, err)
 	}
@@ -93,13 +150,28 @@ func (r *userRepository) Update(user *models.User) error {
 	const op = "userRepository.Update"
 
 	res, err := r.db.Exec(
-		`UPDATE user SET capacity = $1, rate_per_sec = $2, tokens = $3 WHERE id = $4`,
+		`
+			UPDATE client
+			SET capacity = $1, rate_per_sec = $2, window_sec = $3, tokens = $4, algorithm = $5, quota_limit = $6,
+				quota_period = $7, max_concurrent = $8, plan_id = $9, shadow = $10
+			WHERE id = $11
+		`,
 		user.Capacity,
 		user.RatePerSec,
+		user.WindowSec,
 		user.Tokens,
+		user.Algorithm,
+		user.QuotaLimit,
+		user.QuotaPeriod,
+		user.MaxConcurrent,
+		user.PlanID,
+		user.Shadow,
 		user.ID,
 	)
 	if err != nil {
+		if isPQError(err, pqForeignKeyViolation) {
+			return fmt.Errorf("%s: %w", op, ErrPlanNotFound)
+		}
 		return fmt.Errorf("%s: %w", op, err)
 	}
 	rowsAffected, err := res.RowsAffected()
@@ -116,7 +188,7 @@ func (r *userRepository) UpdateTokens(id uint64, tokens int) (bool, error) {
 	const op = "userRepository.UpdateTokens"
 
 	res, err := r.db.Exec(`
-		UPDATE users SET tokens=$1 WHERE id=$2
+		UPDATE client SET tokens=$1 WHERE id=$2
 	`, tokens, id)
 	if err != nil {
 		return false, fmt.Errorf("%s: %w", op, err)
@@ -131,11 +203,43 @@ func (r *userRepository) UpdateTokens(id uint64, tokens int) (bool, error) {
 	return true, nil
 }
 
+func (r *userRepository) UpdateTokensBatch(updates []TokensUpdate) error {
+	const op = "userRepository.UpdateTokensBatch"
+
+	if len(updates) == 0 {
+		return nil
+	}
+	ids := make([]int64, len(updates))
+	tokens := make([]int64, len(updates))
+	lastUpdated := make([]string, len(updates))
+	for i, u := range updates {
+		ids[i] = int64(u.ID)
+		tokens[i] = int64(u.Tokens)
+		lastUpdated[i] = u.LastUpdated.Format(time.RFC3339Nano)
+	}
+
+	_, err := r.db.Exec(`
+		UPDATE client AS c
+		SET tokens = v.tokens, last_updated = v.last_updated
+		FROM (
+			SELECT
+				unnest($1::bigint[]) AS id,
+				unnest($2::integer[]) AS tokens,
+				unnest($3::timestamptz[]) AS last_updated
+		) AS v
+		WHERE c.id = v.id
+	`, pq.Array(ids), pq.Array(tokens), pq.Array(lastUpdated))
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	return nil
+}
+
 func (r *userRepository) UpdateCapacity(id uint64, capacity int) (bool, error) {
 	const op = "userRepository.UpdateCapacity"
 
 	res, err := r.db.Exec(`
-		UPDATE users SET capacity=$1 WHERE id=$2
+		UPDATE client SET capacity=$1 WHERE id=$2
 	`, capacity, id)
 	if err != nil {
 		return false, fmt.Errorf("%s: %w", op, err)
@@ -154,7 +258,7 @@ func (r *userRepository) UpdateRatePerSec(id uint64, ratePerSecond int) (bool, e
 	const op = "userRepository.UpdateRatePerSec"
 
 	res, err := r.db.Exec(`
-		UPDATE users SET rate_per_sec=$1 WHERE id=$2
+		UPDATE client SET rate_per_sec=$1 WHERE id=$2
 	`, ratePerSecond, id)
 	if err != nil {
 		return false, fmt.Errorf("%s: %w", op, err)